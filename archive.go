@@ -0,0 +1,184 @@
+package xre
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+// tarExts and zipExts are the archive file name extensions that IsArchiveName
+// recognizes.
+var (
+	tarExts = []string{".tar", ".tar.gz", ".tgz", ".tar.bz2", ".tbz", ".tbz2", ".tar.Z"}
+	zipExts = []string{".zip"}
+)
+
+// IsArchiveName returns true if the given file name looks like a tar
+// (possibly compressed) or zip archive.
+func IsArchiveName(name string) bool {
+	return hasAnySuffix(name, tarExts) || hasAnySuffix(name, zipExts)
+}
+
+func hasAnySuffix(s string, suffixes []string) bool {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(s, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// expandArchive calls add with an input for every regular member of the given
+// archive stream, named like "archive.tar!path/inside"; it stops early if add
+// returns false, or once done is closed. The archive stream is closed once all
+// of its member streams have been.
+//
+// Since tar archives can only be read sequentially, each tar member must be
+// closed before the next one is added.
+func expandArchive(rc io.ReadCloser, done <-chan struct{}, add func(Input) bool) {
+	name := inputName(Input{rc, nil})
+	if hasAnySuffix(name, zipExts) {
+		expandZip(name, rc, done, add)
+	} else {
+		expandTar(name, rc, done, add)
+	}
+}
+
+func expandTar(name string, rc io.ReadCloser, done <-chan struct{}, add func(Input) bool) {
+	defer func() { _ = rc.Close() }()
+	var r io.Reader = rc
+	if _, isDecompressed := rc.(*decompressor); !isDecompressed && !strings.HasSuffix(name, ".tar") {
+		drc, err := Decompress(rc)
+		if err != nil {
+			add(Input{nil, err})
+			return
+		}
+		r = drc
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			add(Input{nil, inputError(name, err)})
+			return
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+		closed := make(chan struct{})
+		m := &archiveMember{
+			Reader: tr,
+			name:   memberName(name, hdr.Name),
+			closed: func() { close(closed) },
+		}
+		if !add(Input{m, nil}) {
+			return
+		}
+		select {
+		case <-closed:
+		case <-done:
+			return
+		}
+	}
+}
+
+func expandZip(name string, rc io.ReadCloser, done <-chan struct{}, add func(Input) bool) {
+	var wg sync.WaitGroup
+	defer func() {
+		go func() {
+			wg.Wait()
+			_ = rc.Close()
+		}()
+	}()
+
+	ra, size, err := readerAt(rc)
+	if err != nil {
+		add(Input{nil, inputError(name, err)})
+		return
+	}
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		add(Input{nil, inputError(name, err)})
+		return
+	}
+	for _, zf := range zr.File {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if !zf.Mode().IsRegular() {
+			continue
+		}
+		mname := memberName(name, zf.Name)
+		r, err := zf.Open()
+		if err != nil {
+			if !add(Input{nil, inputError(mname, err)}) {
+				return
+			}
+			continue
+		}
+		wg.Add(1)
+		m := &archiveMember{
+			Reader: r,
+			name:   mname,
+			closed: func() {
+				_ = r.Close()
+				wg.Done()
+			},
+		}
+		if !add(Input{m, nil}) {
+			return
+		}
+	}
+}
+
+// readerAt returns random access to the given stream's content, either
+// directly if it's a file, or by reading it into memory.
+func readerAt(rc io.ReadCloser) (io.ReaderAt, int64, error) {
+	if f, ok := rc.(*os.File); ok {
+		if info, err := f.Stat(); err == nil && info.Mode().IsRegular() {
+			return f, info.Size(), nil
+		}
+	}
+	buf, err := ioutil.ReadAll(rc)
+	return bytes.NewReader(buf), int64(len(buf)), err
+}
+
+func memberName(archive, path string) string {
+	if archive == "" {
+		return path
+	}
+	return archive + "!" + path
+}
+
+// archiveMember is the input stream for a single archive member.
+type archiveMember struct {
+	io.Reader
+	name   string
+	once   sync.Once
+	closed func()
+}
+
+// Name returns the member's name, qualified by its archive's name.
+func (am *archiveMember) Name() string { return am.name }
+
+func (am *archiveMember) Read(p []byte) (int, error) {
+	n, err := am.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		err = inputError(am.name, err)
+	}
+	return n, err
+}
+
+func (am *archiveMember) Close() error {
+	am.once.Do(am.closed)
+	return nil
+}
@@ -0,0 +1,123 @@
+package xre_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jcorbin/xre"
+)
+
+var archiveTestMembers = []struct{ name, body string }{
+	{"src/a.txt", "one\ntwo"},
+	{"src/sub/b.txt", "three\nfour\n"},
+}
+
+func archiveTestTar(t *testing.T, gz bool) []byte {
+	var buf bytes.Buffer
+	var tw *tar.Writer
+	var zw *gzip.Writer
+	if gz {
+		zw = gzip.NewWriter(&buf)
+		tw = tar.NewWriter(zw)
+	} else {
+		tw = tar.NewWriter(&buf)
+	}
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "src/", Typeflag: tar.TypeDir, Mode: 0755}))
+	for _, m := range archiveTestMembers {
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Name:     m.name,
+			Typeflag: tar.TypeReg,
+			Mode:     0644,
+			Size:     int64(len(m.body)),
+		}))
+		_, err := tw.Write([]byte(m.body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "src/link", Typeflag: tar.TypeSymlink, Linkname: "a.txt"}))
+	require.NoError(t, tw.Close())
+	if zw != nil {
+		require.NoError(t, zw.Close())
+	}
+	return buf.Bytes()
+}
+
+func archiveTestZip(t *testing.T) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	_, err := zw.Create("src/")
+	require.NoError(t, err)
+	for _, m := range archiveTestMembers {
+		w, err := zw.Create(m.name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(m.body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestFileEnv_Archives(t *testing.T) {
+	tarData := archiveTestTar(t, false)
+	tgzData := archiveTestTar(t, true)
+	zipData := archiveTestZip(t)
+
+	fe := xre.FileEnv{Archives: true}
+	fe.AddReader(namedReader{bytes.NewReader(tarData), "t.tar"}, nil)
+	go func() {
+		defer fe.CloseInputs()
+		fe.AddReader(namedReader{bytes.NewReader(tgzData), "t.tgz"}, nil)
+		fe.AddReader(namedReader{strings.NewReader("plain"), "plain.txt"}, nil)
+		fe.AddReader(namedReader{bytes.NewReader(zipData), "t.zip"}, nil)
+		fe.AddReader(namedReader{bytes.NewReader(tarData[:700]), "trunc.tar"}, nil)
+	}()
+
+	var got []string
+	for in := range fe.Inputs() {
+		if in.Err != nil {
+			got = append(got, "error "+in.Err.Error())
+			continue
+		}
+		name := in.ReadCloser.(interface{ Name() string }).Name()
+		body, err := ioutil.ReadAll(in)
+		if err != nil {
+			got = append(got, name+" error "+err.Error())
+		} else {
+			got = append(got, name+" "+string(body))
+		}
+		assert.NoError(t, in.Close(), "unexpected close error")
+	}
+
+	assert.Equal(t, []string{
+		"t.tar!src/a.txt one\ntwo",
+		"t.tar!src/sub/b.txt three\nfour\n",
+		"t.tgz!src/a.txt one\ntwo",
+		"t.tgz!src/sub/b.txt three\nfour\n",
+		"plain.txt plain",
+		"t.zip!src/a.txt one\ntwo",
+		"t.zip!src/sub/b.txt three\nfour\n",
+		"error trunc.tar: unexpected EOF",
+	}, got)
+}
+
+func TestIsArchiveName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"foo.tar":     true,
+		"foo.tar.gz":  true,
+		"foo.tgz":     true,
+		"foo.tar.bz2": true,
+		"foo.zip":     true,
+		"foo.gz":      false,
+		"foo.txt":     false,
+		"tar":         false,
+	} {
+		assert.Equal(t, want, xre.IsArchiveName(name), "IsArchiveName(%q)", name)
+	}
+}
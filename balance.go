@@ -1,5 +1,16 @@
 package xre
 
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
 var balancedOpens = map[byte]byte{
 	'[': ']',
 	'{': '}',
@@ -7,42 +18,226 @@ var balancedOpens = map[byte]byte{
 	'<': '>',
 }
 
-type betweenBalanced struct{ open, close byte }
+// defaultQuotes are the quote characters skipped over by a quote-aware
+// balanced command, unless others are given.
+const defaultQuotes = "\"'`"
+
+// Besides its outermost pairs, a balanced command may select pairs at a given
+// nesting depth, e.g. x{2, or at every depth, e.g. x{* in order of their
+// opening (outermost first), or x{*i in order of their closing (innermost
+// first).
+const (
+	everyDepth      = -1
+	everyDepthInner = -2
+)
+
+type betweenBalanced struct {
+	open, close byte
+	quotes      string
+	depth       int
+}
 type extractBalanced betweenBalanced
 
+// scanBalancedSpec parses the rest of a balanced command after its opening
+// brace c: an optional depth selector, then an optional q suffix to make it
+// quote-aware, optionally followed by a string of quote characters to use
+// instead of defaultQuotes.
+func scanBalancedSpec(c byte, s string) (betweenBalanced, string, error) {
+	bb := betweenBalanced{open: c, close: balancedOpens[c]}
+	if len(s) > 0 && s[0] == '*' {
+		bb.depth, s = everyDepth, s[1:]
+		if len(s) > 0 && s[0] == 'i' {
+			bb.depth, s = everyDepthInner, s[1:]
+		}
+	} else if n, rest, err := scanInt(s); err != nil {
+		return bb, rest, err
+	} else if rest != s {
+		if n < 1 {
+			return bb, rest, fmt.Errorf("invalid balanced depth %v", n)
+		}
+		bb.depth, s = n, rest
+	}
+	if len(s) == 0 || s[0] != 'q' {
+		return bb, s, nil
+	}
+	s = s[1:]
+	bb.quotes = defaultQuotes
+	if len(s) > 0 && s[0] == '"' {
+		quotes, rest, err := scanString(s[0], s[1:])
+		if err != nil {
+			return bb, rest, err
+		}
+		if quotes == "" {
+			return bb, rest, errors.New("empty quote set")
+		}
+		bb.quotes, s = quotes, rest
+	}
+	return bb, s, nil
+}
+
+// scanInt scans any leading decimal digits from s.
+func scanInt(s string) (int, string, error) {
+	i := 0
+	for i < len(s) && '0' <= s[i] && s[i] <= '9' {
+		i++
+	}
+	if i == 0 {
+		return 0, s, nil
+	}
+	n, err := strconv.Atoi(s[:i])
+	return n, s[i:], err
+}
+
 func (bb betweenBalanced) match(mp *matchProcessor, buf []byte) error {
-	if loc, found := scanBalanced(bb.open, bb.close, buf); found {
+	if bb.depth > 1 || bb.depth < 0 {
+		return bb.matchNested(mp, buf, 1)
+	}
+	if loc, found := scanBalanced(bb.open, bb.close, bb.quotes, buf, mp.buf.Err() == io.EOF); found {
 		return mp.pushLoc(loc[0]+1, loc[1]-1, loc[1])
 	}
 	return nil
 }
 
 func (eb extractBalanced) match(mp *matchProcessor, buf []byte) error {
-	if loc, found := scanBalanced(eb.open, eb.close, buf); found {
+	if eb.depth > 1 || eb.depth < 0 {
+		return betweenBalanced(eb).matchNested(mp, buf, 0)
+	}
+	if loc, found := scanBalanced(eb.open, eb.close, eb.quotes, buf, mp.buf.Err() == io.EOF); found {
 		return mp.pushLoc(loc[0], loc[1], loc[1])
 	}
 	return nil
 }
 
-func scanBalanced(open, close byte, buf []byte) ([2]int, bool) {
-	// TODO escaping? quoting?
+// matchNested processes every selected pair within the first outermost pair in
+// buf, trimming each by trim bytes on either side. Since selected pairs may
+// overlap, all but the last are processed directly, rather than through
+// pushLoc.
+func (bb betweenBalanced) matchNested(mp *matchProcessor, buf []byte, trim int) error {
+	var locs [][2]int
+	loc, found := scanBalancedFunc(bb.open, bb.close, bb.quotes, buf, mp.buf.Err() == io.EOF, func(start, end, depth int) {
+		if bb.depth < 0 || depth == bb.depth {
+			locs = append(locs, [2]int{start + trim, end - trim})
+		}
+	})
+	if !found {
+		return nil
+	}
+	if bb.depth != everyDepthInner {
+		sort.Slice(locs, func(i, j int) bool { return locs[i][0] < locs[j][0] })
+	}
+
+	// A final token ending the buffer would be forgotten, and re-matched
+	// once more input arrives; so wait for more input before processing any.
+	if len(locs) > 0 && locs[len(locs)-1][1] == loc[1] &&
+		loc[1] == len(buf) && mp.buf.Err() != io.EOF {
+		return nil
+	}
+
+	if err := mp.procPrior(false); err != nil {
+		return err
+	}
+	if len(locs) == 0 {
+		mp.buf.Advance(loc[1])
+		return nil
+	}
+	for _, l := range locs[:len(locs)-1] {
+		if err := mp.yield(buf[l[0]:l[1]], false); err != nil {
+			return err
+		}
+	}
+	last := locs[len(locs)-1]
+	return mp.pushLoc(last[0], last[1], loc[1])
+}
+
+// scanBalanced finds the first balanced open/close pair in buf. If any quotes
+// are given, then any open/close bytes within a quoted string are ignored, such
+// strings starting with one of the quote bytes and ending with the same one;
+// backslash escapes are honored within any but backtick quoted strings.
+//
+// Quoted strings are only recognized within a pair, so that e.g. apostrophes
+// in any surrounding prose aren't mistaken for quotes. If a quote within a pair
+// is unterminated, such as an apostrophe in a comment, then the pair is scanned
+// again without any quotes, rather than never found: any but a backtick quote
+// is unterminated at the end of its line, and any at all atEOF.
+func scanBalanced(open, close byte, quotes string, buf []byte, atEOF bool) ([2]int, bool) {
+	return scanBalancedFunc(open, close, quotes, buf, atEOF, nil)
+}
+
+// scanBalancedFunc is scanBalanced, but also calls each (if non-nil) for every
+// pair closed within the first outermost pair once it's found, with its depth
+// starting from 1 for the outermost pair itself.
+func scanBalancedFunc(
+	open, close byte, quotes string, buf []byte, atEOF bool,
+	each func(start, end, depth int),
+) ([2]int, bool) {
+	type pair struct{ start, end, depth int }
+	var (
+		starts []int
+		pairs  []pair
+	)
 	level, start := 0, 0
+	unquoted := func() ([2]int, bool) {
+		var unquotedEach func(start, end, depth int)
+		if each != nil {
+			unquotedEach = func(s, e, depth int) { each(start+s, start+e, depth) }
+		}
+		loc, found := scanBalancedFunc(open, close, "", buf[start:], atEOF, unquotedEach)
+		if found {
+			loc[0] += start
+			loc[1] += start
+		}
+		return loc, found
+	}
+	var quote byte
 	for off := 0; off < len(buf); off++ {
-		switch buf[off] {
+		c := buf[off]
+		if quote != 0 {
+			switch {
+			case c == '\\' && quote != '`':
+				off++
+			case c == quote:
+				quote = 0
+			case c == '\n' && quote != '`':
+				return unquoted()
+			}
+			continue
+		}
+		switch c {
 		case open:
 			if level == 0 {
 				start = off
+				starts = starts[:0]
+				pairs = pairs[:0]
 			}
 			level++
+			if each != nil {
+				starts = append(starts, off)
+			}
 		case close:
 			level--
 			if level < 0 {
 				level = 0
-			} else if level == 0 {
+				continue
+			}
+			if each != nil {
+				pairs = append(pairs, pair{starts[level], off + 1, level + 1})
+				starts = starts[:level]
+			}
+			if level == 0 {
+				for _, p := range pairs {
+					each(p.start, p.end, p.depth)
+				}
 				return [2]int{start, off + 1}, true
 			}
+		default:
+			if level > 0 && quotes != "" && strings.IndexByte(quotes, c) >= 0 {
+				quote = c
+			}
 		}
 	}
+	if quote != 0 && atEOF {
+		return unquoted()
+	}
 	return [2]int{0, 0}, false
 }
 
@@ -52,3 +247,169 @@ func (bb betweenBalanced) Create(next Processor) Processor {
 func (eb extractBalanced) Create(next Processor) Processor {
 	return &matchProcessor{next: next, matcher: eb}
 }
+
+// spec returns the command string of a balanced command after its x or y.
+func (bb betweenBalanced) spec() string {
+	spec := string(bb.open)
+	switch {
+	case bb.depth == everyDepth:
+		spec += "*"
+	case bb.depth == everyDepthInner:
+		spec += "*i"
+	case bb.depth > 0:
+		spec += strconv.Itoa(bb.depth)
+	}
+	switch bb.quotes {
+	case "":
+		return spec
+	case defaultQuotes:
+		return spec + "q"
+	default:
+		return spec + "q" + stringSpec(bb.quotes)
+	}
+}
+
+// stringSpec returns a double quoted command string for s; since scanString
+// doesn't support escaping its delimiter, any double quote is hex escaped.
+func stringSpec(s string) string {
+	q := strconv.Quote(s)
+	return `"` + strings.Replace(q[1:len(q)-1], `\"`, `\x22`, -1) + `"`
+}
+
+// delimFinder finds the next delimiter within a buffer, for betweenDelimited
+// and extractDelimited.
+type delimFinder interface {
+	find(buf []byte) (loc [2]int, found bool)
+	fmt.Stringer
+}
+
+type literalDelim string
+type patternDelim struct{ pat *regexp.Regexp }
+
+func (ld literalDelim) find(buf []byte) ([2]int, bool) {
+	if i := bytes.Index(buf, []byte(ld)); i >= 0 {
+		return [2]int{i, i + len(ld)}, true
+	}
+	return [2]int{}, false
+}
+
+func (pd patternDelim) find(buf []byte) ([2]int, bool) {
+	if loc := pd.pat.FindIndex(buf); loc != nil {
+		return [2]int{loc[0], loc[1]}, true
+	}
+	return [2]int{}, false
+}
+
+func (ld literalDelim) String() string { return stringSpec(string(ld)) }
+func (pd patternDelim) String() string { return regexpString(pd.pat) }
+
+// betweenDelimited and extractDelimited are like betweenBalanced and
+// extractBalanced, but with arbitrary open and close delimiters, e.g.
+// y("/*","*/") or x(/^#if/,/^#endif/).
+type betweenDelimited struct{ open, close delimFinder }
+type extractDelimited betweenDelimited
+
+var errEmptyDelim = errors.New("balanced delimiter matched empty string")
+
+// scanDelimitedSpec parses the rest of a delimited balanced command after its
+// opening "(": two literal strings or patterns, separated by a comma, and
+// followed by a closing ")".
+func scanDelimitedSpec(s string) (betweenDelimited, string, error) {
+	var bd betweenDelimited
+	var err error
+	if bd.open, s, err = scanDelimFinder(s); err != nil {
+		return bd, s, err
+	}
+	if len(s) == 0 || s[0] != ',' {
+		return bd, s, errors.New("expected , between balanced delimiters")
+	}
+	if bd.close, s, err = scanDelimFinder(s[1:]); err != nil {
+		return bd, s, err
+	}
+	if len(s) == 0 || s[0] != ')' {
+		return bd, s, errors.New("expected ) after balanced delimiters")
+	}
+	return bd, s[1:], nil
+}
+
+func scanDelimFinder(s string) (delimFinder, string, error) {
+	if len(s) == 0 {
+		return nil, s, errors.New("missing balanced delimiter")
+	}
+	switch c := s[0]; c {
+	case '"':
+		delim, s, err := scanString(c, s[1:])
+		if err == nil && delim == "" {
+			err = errors.New("empty balanced delimiter")
+		}
+		return literalDelim(delim), s, err
+	case '/':
+		pat, s, err := scanPat(c, s[1:])
+		if err != nil {
+			return nil, s, err
+		}
+		return patternDelim{pat}, s, nil
+	default:
+		return nil, s, fmt.Errorf("invalid balanced delimiter %q", c)
+	}
+}
+
+func (bd betweenDelimited) match(mp *matchProcessor, buf []byte) error {
+	loc, found, err := scanDelimited(bd.open, bd.close, buf)
+	if found {
+		return mp.pushLoc(loc[1], loc[2], loc[3])
+	}
+	return err
+}
+
+func (ed extractDelimited) match(mp *matchProcessor, buf []byte) error {
+	loc, found, err := scanDelimited(ed.open, ed.close, buf)
+	if found {
+		return mp.pushLoc(loc[0], loc[3], loc[3])
+	}
+	return err
+}
+
+// scanDelimited finds the first balanced region in buf, starting with an
+// open delimiter, and ending with its matching close delimiter; any open
+// delimiter before the matching close nests another level. The returned loc is
+// the start and end of the open delimiter, followed by the start and end of the
+// close delimiter.
+func scanDelimited(open, close delimFinder, buf []byte) (loc [4]int, found bool, err error) {
+	o, found := open.find(buf)
+	if !found {
+		return loc, false, nil
+	} else if o[0] == o[1] {
+		return loc, false, errEmptyDelim
+	}
+	level, off := 1, o[1]
+	for {
+		c, found := close.find(buf[off:])
+		if !found {
+			return loc, false, nil
+		} else if c[0] == c[1] {
+			return loc, false, errEmptyDelim
+		}
+		if no, found := open.find(buf[off:]); found && no[0] < c[0] {
+			if no[0] == no[1] {
+				return loc, false, errEmptyDelim
+			}
+			level++
+			off += no[1]
+			continue
+		}
+		if level--; level == 0 {
+			return [4]int{o[0], o[1], off + c[0], off + c[1]}, true, nil
+		}
+		off += c[1]
+	}
+}
+
+func (bd betweenDelimited) spec() string { return fmt.Sprintf("(%v,%v)", bd.open, bd.close) }
+
+func (bd betweenDelimited) Create(next Processor) Processor {
+	return &matchProcessor{next: next, matcher: bd}
+}
+func (ed extractDelimited) Create(next Processor) Processor {
+	return &matchProcessor{next: next, matcher: ed}
+}
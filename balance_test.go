@@ -1,6 +1,9 @@
 package xre_test
 
-import "testing"
+import (
+	"errors"
+	"testing"
+)
 
 var fizzBuzzCode = stripBlockSpace(`
 import "fmt"
@@ -48,3 +51,208 @@ func Test_between_balanced(t *testing.T) {
 		},
 	}.run(t)
 }
+
+var quotedCode = []byte(`x := map[string]string{"a}": "b{", ` + "`c\\}`" + `: "d", "e\"}": "f"}
+fmt.Printf("%v\n", struct{ s string }{"\\"})
+don't {'}'}
+`)
+
+func Test_balanced_quotes(t *testing.T) {
+	cmdTestCases{
+		{name: "extract quote aware",
+			cmd: `x{q p%"%q\n"`,
+			in:  quotedCode,
+			out: []byte(`"{\"a}\": \"b{\", ` + "`c\\\\}`" + `: \"d\", \"e\\\"}\": \"f\"}"
+"{ s string }"
+"{\"\\\\\"}"
+"{'}'}"
+`),
+		},
+		{name: "between quote aware",
+			cmd: `y{q p%"%q\n"`,
+			in:  quotedCode,
+			out: []byte(`"\"a}\": \"b{\", ` + "`c\\\\}`" + `: \"d\", \"e\\\"}\": \"f\""
+" s string "
+"\"\\\\\""
+"'}'"
+`),
+		},
+		{name: "double quotes only",
+			cmd: `x{q"\x22" p%"%q\n"`,
+			in:  []byte(`{"}"} {'}'}`),
+			out: []byte(`"{\"}\"}"
+"{'}"
+`),
+		},
+		{name: "unaware",
+			cmd: `x{ p%"%q\n"`,
+			in:  []byte(`{"}"}`),
+			out: []byte(`"{\"}"
+`),
+		},
+		{name: "unterminated apostrophe",
+			cmd: `x{q p%"%q\n"`,
+			in:  []byte(`{it's} {x}`),
+			out: []byte(`"{it's}"
+"{x}"
+`),
+		},
+		{name: "unterminated apostrophe in comment",
+			cmd: `y{q p%"%q\n"`,
+			in:  []byte("f() {\n\t// don't\n\ta()\n}\ng() {\n\tb(\"}\")\n}\n"),
+			out: []byte(`"\n\t// don't\n\ta()\n"
+"\n\tb(\"}\")\n"
+`),
+		},
+		{name: "unterminated apostrophe before more input",
+			cmd: `x{q p%"%q\n"`,
+			in:  readFixture("{ it's\n}\n", errors.New("bang"), "{x}"),
+			out: []byte(`"{ it's\n}"
+`),
+			err: "bang",
+		},
+		{name: "unterminated double quote ends its line",
+			cmd: `x{q p%"%q\n"`,
+			in:  []byte("{a \"b\n} {\"}\"}\n"),
+			out: []byte(`"{a \"b\n}"
+"{\"}\"}"
+`),
+		},
+		{name: "backtick quote spans lines",
+			cmd: `x{q p%"%q\n"`,
+			in:  []byte("{`a\n}`}\n"),
+			out: []byte(`"{` + "`a\\n}`" + `}"
+`),
+		},
+		{name: "unterminated apostrophe every depth",
+			cmd: `x{*q p%"%q\n"`,
+			in:  []byte(`{it's {a}} {b}`),
+			out: []byte(`"{it's {a}}"
+"{a}"
+"{b}"
+`),
+		},
+	}.run(t)
+}
+
+var ifdefCode = []byte(`#include <a.h>
+#if A
+int a;
+#if B
+int b;
+#endif
+#endif
+int c;
+#ifdef D
+int d;
+#endif
+`)
+
+func Test_balanced_delimited(t *testing.T) {
+	cmdTestCases{
+		{name: "extract nested comments",
+			cmd: `x("/*","*/") p%"%q\n"`,
+			in:  []byte(`a /* one /* two */ three */ b /* four */ c`),
+			out: []byte(`"/* one /* two */ three */"
+"/* four */"
+`),
+		},
+		{name: "between nested comments",
+			cmd: `y("/*","*/") p%"%q\n"`,
+			in:  []byte(`a /* one /* two */ three */ b /* four */ c`),
+			out: []byte(`" one /* two */ three "
+" four "
+`),
+		},
+		{name: "html comments",
+			cmd: `y("<!--","-->") p%"%q\n"`,
+			in:  []byte(`<p>hi</p><!-- note --><p>bye</p><!--x-->`),
+			out: []byte(`" note "
+"x"
+`),
+		},
+		{name: "ifdef blocks",
+			cmd: `x(/(?m)^#if/,/(?m)^#endif\n/) p%"%q\n"`,
+			in:  ifdefCode,
+			out: []byte(`"#if A\nint a;\n#if B\nint b;\n#endif\n#endif\n"
+"#ifdef D\nint d;\n#endif\n"
+`),
+		},
+		{name: "transactions",
+			cmd: `y(/BEGIN;\s*/,"END;") p"\n"`,
+			in:  []byte("BEGIN; a; END; BEGIN;\n\tb;\nEND; BEGIN; c;"),
+			out: []byte("a; \nb;\n\n"),
+		},
+	}.run(t)
+}
+
+var nestedBraces = []byte(`a{1{2{3}}{4}} b{5 "}"} c{}`)
+
+func Test_balanced_depth(t *testing.T) {
+	cmdTestCases{
+		{name: "extract depth 2",
+			cmd: `x{2 p%"%q\n"`,
+			in:  nestedBraces,
+			out: []byte(`"{2{3}}"
+"{4}"
+`),
+		},
+		{name: "between depth 2",
+			cmd: `y{2 p%"%q\n"`,
+			in:  nestedBraces,
+			out: []byte(`"2{3}"
+"4"
+`),
+		},
+		{name: "extract depth 1",
+			cmd: `x{1 p%"%q\n"`,
+			in:  nestedBraces,
+			out: []byte(`"{1{2{3}}{4}}"
+"{5 \"}"
+"{}"
+`),
+		},
+		{name: "extract every depth",
+			cmd: `x{* p%"%q\n"`,
+			in:  nestedBraces,
+			out: []byte(`"{1{2{3}}{4}}"
+"{2{3}}"
+"{3}"
+"{4}"
+"{5 \"}"
+"{}"
+`),
+		},
+		{name: "extract every depth innermost first",
+			cmd: `x{*i p%"%q\n"`,
+			in:  nestedBraces,
+			out: []byte(`"{3}"
+"{2{3}}"
+"{4}"
+"{1{2{3}}{4}}"
+"{5 \"}"
+"{}"
+`),
+		},
+		{name: "between every depth quote aware",
+			cmd: `y{*q p%"%q\n"`,
+			in:  nestedBraces,
+			out: []byte(`"1{2{3}}{4}"
+"2{3}"
+"3"
+"4"
+"5 \"}\""
+""
+`),
+		},
+		{name: "fizzy code blocks depth 2",
+			cmd: `x{2 p%"%q\n"`,
+			in:  fizzBuzzCode,
+			out: stripBlockSpace(`
+			"{\n\t\tany = true\n\t\tfmt.Printf(\"fizz\")\n\t}"
+			"{\n\t\tany = true\n\t\tfmt.Printf(\"buzz\")\n\t}"
+			"{\n\t\tfmt.Printf(\"\\n\")\n\t}"
+			`),
+		},
+	}.run(t)
+}
@@ -18,9 +18,58 @@ func scanY(s string) (Command, string, error) {
 	}
 	switch c := s[0]; c {
 
+	case '+':
+		if len(s) < 2 || s[1] != '/' && s[1] != '"' {
+			return nil, s, errors.New("expected delimiter string or pattern after y+")
+		}
+		cmd, rest, err := scanY(s[1:])
+		if err != nil {
+			return nil, rest, err
+		}
+		switch impl := cmd.(ProtoCommand).ProtoProcessor.(type) {
+		case betweenDelimRe:
+			if impl.retain == retainSuffix {
+				return nil, rest, errors.New("y delimiter may not be retained both as prefix and suffix")
+			}
+			impl.retain = retainPrefix
+			return ProtoCommand{impl}, rest, nil
+		case betweenDelimSplit:
+			if impl.retain == retainSuffix {
+				return nil, rest, errors.New("y delimiter may not be retained both as prefix and suffix")
+			}
+			impl.retain = retainPrefix
+			return ProtoCommand{impl}, rest, nil
+		}
+		return nil, s, errors.New("expected delimiter string or pattern after y+")
+
 	case '[', '{', '(', '<':
-		s = s[1:]
-		return ProtoCommand{betweenBalanced{c, balancedOpens[c]}}, s, nil
+		if c == '<' {
+			if name, rest, ok := scanElementSpec(s[1:]); ok {
+				return ProtoCommand{betweenElement{name}}, rest, nil
+			}
+		}
+		if c == '(' && len(s) > 1 && (s[1] == '"' || s[1] == '/') {
+			bd, s, err := scanDelimitedSpec(s[1:])
+			if err != nil {
+				return nil, s, err
+			}
+			return ProtoCommand{bd}, s, nil
+		}
+		bb, s, err := scanBalancedSpec(c, s[1:])
+		if err != nil {
+			return nil, s, err
+		}
+		return ProtoCommand{bb}, s, nil
+
+	case '>':
+		xi, s, err := scanIndentSpec(s[1:])
+		if err != nil {
+			return nil, s, err
+		}
+		return ProtoCommand{betweenIndent(xi)}, s, nil
+
+	case 'c':
+		return scanYC(s[1:])
 
 	case '/':
 		// TODO support and optimize to static byte strings when possible
@@ -28,7 +77,11 @@ func scanY(s string) (Command, string, error) {
 		if err != nil {
 			return nil, s, err
 		}
-		return ProtoCommand{betweenDelimRe{pat}}, s, nil
+		bdr := betweenDelimRe{pat: pat}
+		if len(s) > 0 && s[0] == '+' {
+			bdr.retain, s = retainSuffix, s[1:]
+		}
+		return ProtoCommand{bdr}, s, nil
 
 	case '"':
 		delim, s, err := scanString(c, s[1:])
@@ -39,22 +92,41 @@ func scanY(s string) (Command, string, error) {
 		if err != nil {
 			return nil, s, err
 		}
+		var ls lineSplitter
+		if allNewlines(delim) {
+			ls.n = len(delim)
+			for ; len(s) > 0 && (s[0] == 'r' || s[0] == 'u'); s = s[1:] {
+				if s[0] == 'r' {
+					ls.cr = true
+				} else {
+					ls.unicode = true
+				}
+			}
+		}
+		var retain retainMode
+		if len(s) > 0 && s[0] == '+' {
+			retain, s = retainSuffix, s[1:]
+		}
 		if len(s) > 3 && s[0] == '~' && s[1] == '"' {
 			cutset, s, err = scanString(c, s[2:])
 			if err != nil {
 				return nil, s, err
 			}
 		}
-		return ProtoCommand{betweenDelim(delim, cutset)}, s, nil
+		bds := betweenDelim(delim, cutset, ls)
+		bds.retain = retain
+		return ProtoCommand{bds}, s, nil
 
 	default:
 		return nil, s, fmt.Errorf("unrecognized y command")
 	}
 }
 
-func betweenDelim(delim, cutset string) (bds betweenDelimSplit) {
-	if allNewlines(delim) && cutset == "" {
-		bds.split = lineSplitter(len(delim))
+// betweenDelim returns a command that splits at delim, trimming cutset from
+// each token; ls gives any line splitting options if delim is all newlines.
+func betweenDelim(delim, cutset string, ls lineSplitter) (bds betweenDelimSplit) {
+	if allNewlines(delim) {
+		bds.split = ls
 	} else if len(delim) == 1 {
 		bds.split = byteSplitter(delim[0])
 	} else {
@@ -66,16 +138,56 @@ func betweenDelim(delim, cutset string) (bds betweenDelimSplit) {
 	return bds
 }
 
-type betweenDelimRe struct{ pat *regexp.Regexp }
-type betweenDelimSplit struct{ split splitter }
+type betweenDelimRe struct {
+	pat    *regexp.Regexp
+	retain retainMode
+}
+type betweenDelimSplit struct {
+	split  splitter
+	retain retainMode
+}
+
+// retainMode determines whether each delimiter is discarded between tokens,
+// or retained at the start of the token following it (prefix) or at the end
+// of the token preceding it (suffix). In prefix mode, any content before the
+// first delimiter is its own token.
+type retainMode uint8
+
+const (
+	retainNone retainMode = iota
+	retainPrefix
+	retainSuffix
+)
 
 type splitter interface {
 	Split(data []byte, atEOF bool) (advance int, token []byte, err error)
 }
 
 func (bdr betweenDelimRe) match(mp *matchProcessor, buf []byte) error {
-	if loc := bdr.pat.FindIndex(buf); loc != nil {
-		return mp.pushLoc(0, loc[0], loc[1])
+	loc := bdr.pat.FindIndex(buf)
+	if loc != nil {
+		switch bdr.retain {
+		case retainNone:
+			return mp.pushLoc(0, loc[0], loc[1])
+		case retainSuffix:
+			return mp.pushLoc(0, loc[1], loc[1])
+		}
+		if loc[0] > 0 {
+			// content before the first delimiter
+			return mp.pushLoc(0, loc[0], loc[0])
+		}
+
+		// the token runs from this delimiter up to the next one, searching
+		// past any empty match to ensure progress
+		off := loc[1]
+		if off == 0 {
+			off = 1
+		}
+		if off <= len(buf) {
+			if next := bdr.pat.FindIndex(buf[off:]); next != nil {
+				return mp.pushLoc(0, off+next[0], off+next[0])
+			}
+		}
 	}
 	if mp.buf.Err() == io.EOF {
 		return mp.flushTrailer()
@@ -86,6 +198,10 @@ func (bdr betweenDelimRe) match(mp *matchProcessor, buf []byte) error {
 func (bds betweenDelimSplit) match(mp *matchProcessor, buf []byte) error {
 	// TODO refactor splitter; unify with matcher
 
+	if bds.retain != retainNone {
+		return bds.matchRetained(mp, buf)
+	}
+
 	advance, token, err := bds.split.Split(buf, mp.buf.Err() == io.EOF)
 	if err == nil {
 		if advance < 0 {
@@ -106,6 +222,48 @@ func (bds betweenDelimSplit) match(mp *matchProcessor, buf []byte) error {
 	return mp.pushLoc(start, end, advance)
 }
 
+// matchRetained splits with the untrimmed splitter, so that each delimiter
+// lies between the end of a token and its advance, and then trims the whole
+// retained token.
+func (bds betweenDelimSplit) matchRetained(mp *matchProcessor, buf []byte) error {
+	atEOF := mp.buf.Err() == io.EOF
+	sp, cutset := untrimmedSplitter(bds.split)
+
+	advance, token, err := sp.Split(buf, atEOF)
+	if err != nil || token == nil {
+		return err
+	}
+	end := advance
+	if bds.retain == retainPrefix {
+		if len(token) > 0 {
+			// content before the first delimiter
+			end = len(token)
+		} else if advance < len(buf) || atEOF {
+			n, token, err := sp.Split(buf[advance:], atEOF)
+			if err != nil {
+				return err
+			}
+			if token == nil && !atEOF {
+				return nil
+			}
+			if n > len(token) {
+				end += len(token)
+			} else {
+				end += n
+			}
+		} else {
+			return nil
+		}
+	}
+
+	retained := buf[:end]
+	if cutset != "" {
+		retained = trim(retained, cutset)
+	}
+	start := cap(buf) - cap(retained)
+	return mp.pushLoc(start, start+len(retained), end)
+}
+
 func (bdr betweenDelimRe) Create(next Processor) Processor {
 	return &matchProcessor{next: next, matcher: bdr}
 }
@@ -113,11 +271,46 @@ func (bds betweenDelimSplit) Create(next Processor) Processor {
 	return &matchProcessor{next: next, matcher: bds}
 }
 
-func (bb betweenBalanced) String() string    { return fmt.Sprintf("y%s", string(bb.open)) }
-func (bdr betweenDelimRe) String() string    { return fmt.Sprintf("y%v", regexpString(bdr.pat)) }
-func (bds betweenDelimSplit) String() string { return fmt.Sprintf("y%v", bds.split) }
+func (bb betweenBalanced) String() string  { return "y" + bb.spec() }
+func (bd betweenDelimited) String() string { return "y" + bd.spec() }
+
+func (bdr betweenDelimRe) String() string {
+	return bdr.retain.wrap("y", regexpString(bdr.pat))
+}
+
+func (bds betweenDelimSplit) String() string {
+	sp, cutset := untrimmedSplitter(bds.split)
+	s := bds.retain.wrap("y", fmt.Sprint(sp))
+	if cutset != "" {
+		s += fmt.Sprintf("~%q", cutset)
+	}
+	return s
+}
+
+// wrap returns the given command name and delimiter spec, marking any
+// retained delimiter with a "+" before (prefix) or after (suffix) the spec.
+func (rm retainMode) wrap(name, spec string) string {
+	switch rm {
+	case retainPrefix:
+		return name + "+" + spec
+	case retainSuffix:
+		return name + spec + "+"
+	default:
+		return name + spec
+	}
+}
 
-func (ls lineSplitter) String() string   { return fmt.Sprintf("%q", strings.Repeat("\n", int(ls))) }
+func (ls lineSplitter) String() string {
+	s := fmt.Sprintf("%q", strings.Repeat("\n", ls.n))
+	if ls.cr {
+		s += "r"
+	}
+	if ls.unicode {
+		s += "u"
+	}
+	return s
+}
+func (st splitTrimmer) String() string   { return fmt.Sprintf("%v~%q", st.splitter, st.cutset) }
 func (bs byteSplitter) String() string   { return fmt.Sprintf("%q", string(bs)) }
 func (bss bytesSplitter) String() string { return fmt.Sprintf("%q", []byte(bss)) }
 func (bst byteSplitTrimmer) String() string {
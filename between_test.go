@@ -117,5 +117,41 @@ func Test_between(t *testing.T) {
 			"the king is dead\nlong live the king\n\n"
 			`),
 		},
+
+		{name: "commit headers retained as prefix",
+			cmd: `y+/^commit\s+/ x/^commit\s+(\w+)/ p"\n"`,
+			in: stripBlockSpace(`
+			commit abc123
+			Author: alice
+
+			commit def456
+			Author: bob
+			`),
+			out: []byte("abc123\ndef456\n"),
+		},
+
+		{name: "content before first prefix delimiter",
+			cmd: `y+/--/ p%"%q\n"`,
+			in:  []byte("pre--a--b\n"),
+			out: []byte("\"pre\"\n\"--a\"\n\"--b\\n\"\n"),
+		},
+
+		{name: "delimiter pattern retained as suffix",
+			cmd: `y/;\s*/+ p%"%q\n"`,
+			in:  []byte("a; b;c"),
+			out: []byte("\"a; \"\n\"b;\"\n\"c\"\n"),
+		},
+
+		{name: "delimiter string retained as prefix",
+			cmd: `y+"--" p%"%q\n"`,
+			in:  []byte("--a--b"),
+			out: []byte("\"--a\"\n\"--b\"\n"),
+		},
+
+		{name: "line terminators retained and trimmed",
+			cmd: `y"\n"r+~" " p%"%q\n"`,
+			in:  []byte("a \r\n b\rc"),
+			out: []byte("\"a \\r\\n\"\n\"b\\r\"\n\"c\"\n"),
+		},
 	}.run(t)
 }
@@ -4,30 +4,100 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"flag"
 	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/jcorbin/xre"
 	"github.com/jcorbin/xre/internal/cmdutil"
 )
 
+// main exits like grep: 0 if any structure was output, 1 if none was, or 2 if
+// any error occurred; however a quiet run that found output still exits 0.
 func main() {
-	if err := run(); err != nil {
-		log.Fatalln(err)
+	err := run()
+	if err != nil {
+		log.Println(err)
+	}
+	switch {
+	case mainEnv.Quiet && mainEnv.Outputs() > 0:
+		os.Exit(0)
+	case err != nil || mainEnv.InputErrors() > 0 || atomic.LoadInt32(&walkErrors) > 0:
+		os.Exit(2)
+	case mainEnv.Outputs() == 0:
+		os.Exit(1)
 	}
 }
 
 var (
-	listIn  = false
-	mainEnv = xre.Stdenv // TODO support redirection
+	listIn    = false
+	count     = false
+	perInput  = false
+	listNul   = false
+	printNul  = false
+	follow    = false
+	jobs      = 1
+	unordered = false
+	shardIn   *os.File
+	recursive = false
+	walk      walker
+	mainEnv   = xre.Stdenv // TODO support redirection
+
+	// walkErrors counts errors logged while walking under -r, which don't
+	// stop it, like grep -r
+	walkErrors int32
 )
 
 func run() (rerr error) {
+	flag.BoolVar(&mainEnv.Decompress, "z", false, "decompress every input whose content is gzip, bzip2, zlib or compress(1) data, including stdin; otherwise only regular files named like one, or starting with gzip, bzip2 or compress(1) magic bytes, are")
+	flag.BoolVar(&mainEnv.Archives, "archives", false, "process each regular member of any .tar, .tar.gz, .tgz or .zip input as its own input, named like archive.tar!path/inside")
+	flag.BoolVar(&mainEnv.Quiet, "q", false, "don't output anything, just stop at the first structure that would have been output")
+	flag.BoolVar(&count, "c", false, "rather than output structures, print how many would have been output")
+	flag.BoolVar(&perInput, "per-input", false, "under -c, print the count for each input as name:count")
+	flag.BoolVar(&mainEnv.KeepGoing, "s", false, "keep going past any input that can't be opened or read, logging its error; the exit status still reflects it")
+	flag.BoolVar(&mainEnv.KeepGoing, "keep-going", false, "same as -s")
 	flag.BoolVar(&listIn, "l", false, "read list of input filenames from stdin or given argument files")
+	flag.BoolVar(&listNul, "0", false, "under -l, input filenames are separated by NUL bytes rather than newlines, as from find -print0")
+	flag.BoolVar(&printNul, "print0", false, "terminate each structure printed by the default output with a NUL byte, as for xargs -0")
+	flag.BoolVar(&follow, "F", false, "follow a single input file as it grows, like tail -F, until interrupted")
+	flag.IntVar(&jobs, "j", 1, "process up to this many inputs in parallel, or shards of a single regular file input; 0 means one per CPU")
+	flag.BoolVar(&unordered, "unordered", false, "under -j, write each input's output as soon as it's done, rather than in input order")
+	flag.BoolVar(&recursive, "r", false, "walk any directory arguments (default .) for input files, not following symlinks found within them")
+	flag.BoolVar(&walk.followLinks, "R", false, "like -r, but following all symlinks")
+	flag.Var(&walk.includes, "include", "under -r, only process files whose base name matches this glob; may be given more than once")
+	flag.Var(&walk.excludes, "exclude", "under -r, skip files whose base name matches this glob; may be given more than once")
+	flag.Var(&walk.excludeDirs, "exclude-dir", "under -r, skip directories whose base name matches this glob; may be given more than once")
+	flag.BoolVar(&walk.noIgnore, "no-ignore", false, "under -r, don't honor .gitignore and .ignore files")
+	flag.BoolVar(&walk.binary, "a", false, "under -r, process binary files rather than skipping them")
+	flag.Var(bufferFlag{&mainEnv}, "buffer", "output buffering: auto, full, structure, line, or a flush interval like 100ms")
+	flag.BoolVar(&mainEnv.Eager, "eager", false, "process each token of the outermost command as soon as it's complete, rather than once the next one is found; implied by -F")
 	flag.Parse()
+	if walk.followLinks {
+		recursive = true
+	}
+	if printNul {
+		mainEnv.OutputDelim = []byte{0}
+	}
+	if perInput {
+		mainEnv.Count = xre.CountPerInput
+	} else if count {
+		mainEnv.Count = xre.CountTotal
+	}
 
-	// TODO SIGPIPE handler
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// our output consumer going away, e.g. `xre ... | head`, stops processing
+	// quietly; handling SIGPIPE also causes the pending write to fail with
+	// EPIPE, rather than the runtime killing us outright.
+	cancelOnSignal(ctx, cancel, syscall.SIGPIPE)
 
 	args := flag.Args()
 
@@ -37,36 +107,207 @@ func run() (rerr error) {
 		args = args[1:]
 	}
 
-	if listIn {
+	if follow {
+		if listIn || len(args) != 1 {
+			return errors.New("-F requires exactly one input file")
+		}
+		// interrupting ends the followed input, rather than the whole run,
+		// so that any final structure still gets processed
+		followCtx, stopFollowing := context.WithCancel(ctx)
+		defer stopFollowing()
+		cancelOnSignal(followCtx, stopFollowing, os.Interrupt, syscall.SIGTERM)
+		mainEnv.Eager = true
+		mainEnv.AddReader(xre.FollowFile(followCtx, args[0], 0))
+		mainEnv.CloseInputs()
+	} else if listIn {
 		scanInfiles(args)
+	} else if recursive {
+		walkArgs(args)
+	} else if jobs != 1 && len(args) == 1 {
+		f, err := shardableFile(args[0])
+		if err != nil {
+			return err
+		}
+		if f != nil {
+			defer func() { _ = f.Close() }()
+			shardIn = f
+		} else {
+			passArgfiles(args)
+		}
 	} else {
 		passArgfiles(args)
 	}
 
-	return cmdutil.WithProf(func() error {
-		return xre.RunCommand(prog, &mainEnv)
+	opts := xre.ParallelOptions{
+		Workers:   jobs,
+		Unordered: unordered,
+	}
+	err := cmdutil.WithProf(func() error {
+		if shardIn != nil {
+			info, err := shardIn.Stat()
+			if err != nil {
+				return err
+			}
+			return xre.RunCommandSharded(ctx, prog, &mainEnv, shardIn, info.Size(), opts)
+		}
+		if jobs != 1 && !follow {
+			return xre.RunCommandParallel(ctx, prog, &mainEnv, opts)
+		}
+		return xre.RunCommandContext(ctx, prog, &mainEnv)
 	})
+	if isBrokenPipe(err) || errors.Is(err, xre.ErrQuit) ||
+		(ctx.Err() != nil && errors.Is(err, context.Canceled)) {
+		err = nil
+	}
+	return err
+}
+
+// cancelOnSignal calls cancel once any of the given signals is received,
+// until the given context is done.
+func cancelOnSignal(ctx context.Context, cancel context.CancelFunc, sigs ...os.Signal) {
+	sigch := make(chan os.Signal, 1)
+	signal.Notify(sigch, sigs...)
+	go func() {
+		defer signal.Stop(sigch)
+		select {
+		case <-sigch:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+}
+
+// bufferFlag sets FileEnv output buffering from either a mode name or an
+// interval duration.
+type bufferFlag struct{ env *xre.FileEnv }
+
+func (bf bufferFlag) String() string {
+	if bf.env == nil {
+		return ""
+	}
+	if bf.env.Buffering == xre.BufferInterval && bf.env.FlushInterval > 0 {
+		return bf.env.FlushInterval.String()
+	}
+	return bf.env.Buffering.String()
+}
+
+func (bf bufferFlag) Set(s string) error {
+	if d, err := time.ParseDuration(s); err == nil {
+		bf.env.Buffering = xre.BufferInterval
+		bf.env.FlushInterval = d
+		return nil
+	}
+	mode, err := xre.ParseBufferMode(s)
+	if err == nil {
+		bf.env.Buffering = mode
+	}
+	return err
+}
+
+func isBrokenPipe(err error) bool {
+	return errors.Is(err, syscall.EPIPE)
+}
+
+// shardableFile opens the named file if it's a regular file, whose contents
+// may then be processed in parallel shards.
+func shardableFile(name string) (*os.File, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := f.Stat(); err != nil || !info.Mode().IsRegular() ||
+		mainEnv.Decompress || compressedFile(f) ||
+		mainEnv.Archives && xre.IsArchiveName(name) {
+		return nil, f.Close()
+	}
+	return f, nil
+}
+
+// compressedExts are file name extensions whose inputs are decompressed even
+// without -z; so is any regular file sniffed to be compressed (see
+// compressedFile), while -z also sniffs other inputs (like stdin), and zlib
+// content, which needs decoding to be told apart from text.
+var compressedExts = []string{".gz", ".tgz", ".bz2", ".tbz", ".tbz2", ".zz", ".Z"}
+
+func compressedName(name string) bool {
+	ext := filepath.Ext(name)
+	for _, ce := range compressedExts {
+		if ext == ce {
+			return true
+		}
+	}
+	return false
+}
+
+// compressedFile returns true if the given file is named like a compressed
+// file, or starts with the magic bytes of one; only regular files are sniffed
+// without -z, since sniffing a pipe (e.g. stdin) would consume from it, and
+// block until enough is written.
+func compressedFile(f *os.File) bool {
+	return compressedName(f.Name()) || xre.SniffCompressed(f)
+}
+
+// addInput adds the given opened file as an input, decompressing it if it's
+// a compressed file.
+func addInput(f *os.File, err error) {
+	if err == nil && f != nil && !mainEnv.Decompress && compressedFile(f) {
+		mainEnv.AddReader(xre.Decompress(f))
+	} else {
+		mainEnv.AddInput(f, err)
+	}
 }
 
 func passArgfiles(args []string) {
 	if len(args) > 0 {
-		mainEnv.AddInput(os.Open(args[0]))
+		addInput(os.Open(args[0]))
 		go func() {
 			defer mainEnv.CloseInputs()
+			done := mainEnv.Done()
 			for _, arg := range args[1:] {
-				mainEnv.AddInput(os.Open(arg))
+				select {
+				case <-done:
+					return
+				default:
+				}
+				addInput(os.Open(arg))
 			}
 		}()
 	}
 }
 
+func walkArgs(args []string) {
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	walk.done = mainEnv.Done()
+	walk.add = addInput
+	walk.warn = func(err error) {
+		log.Println(err)
+		atomic.AddInt32(&walkErrors, 1)
+	}
+	walk.decoded = func(f *os.File) bool {
+		return compressedFile(f) || mainEnv.Archives && xre.IsArchiveName(f.Name())
+	}
+	mainEnv.AddInput(nil, nil)
+	go func() {
+		defer mainEnv.CloseInputs()
+		for _, arg := range args {
+			if !walk.walk(arg) {
+				return
+			}
+		}
+	}()
+}
+
 func scanInfiles(args []string) {
 	mainEnv.AddInput(nil, nil)
 	go func() {
 		defer mainEnv.CloseInputs()
 		if len(args) > 0 {
 			for _, arg := range args {
-				scanInfile(os.Open(arg))
+				if !scanInfile(os.Open(arg)) {
+					return
+				}
 			}
 		} else {
 			scanInfile(mainEnv.DefaultInfile, nil)
@@ -74,11 +315,25 @@ func scanInfiles(args []string) {
 	}()
 }
 
-func scanInfile(f *os.File, err error) {
+// scanInfile adds an input for every file named in the given list file,
+// returning false if the environment was closed before reaching its end.
+func scanInfile(f *os.File, err error) bool {
+	done := mainEnv.Done()
+	stopped := false
 	if err == nil {
 		sc := bufio.NewScanner(f)
+		if listNul {
+			sc.Split(scanNuls)
+		}
+	scan:
 		for sc.Scan() {
-			mainEnv.AddInput(os.Open(sc.Text()))
+			select {
+			case <-done:
+				stopped = true
+				break scan
+			default:
+			}
+			addInput(os.Open(sc.Text()))
 		}
 		err = sc.Err()
 	}
@@ -86,4 +341,20 @@ func scanInfile(f *os.File, err error) {
 	if f != nil {
 		mainEnv.AddInput(nil, f.Close())
 	}
+	return !stopped
+}
+
+// scanNuls is a bufio.SplitFunc for NUL-terminated tokens; like
+// bufio.ScanLines, a final non-terminated token is still returned.
+func scanNuls(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
 }
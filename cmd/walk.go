@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// binarySniffLen is how much of a file is checked for NUL bytes to decide
+// whether it's binary; the same heuristic (and length) that git uses.
+const binarySniffLen = 8000
+
+// ignoreFileNames are the gitignore-style files honored while walking.
+var ignoreFileNames = []string{".gitignore", ".ignore"}
+
+// walker finds files to process under directory trees.
+type walker struct {
+	followLinks bool // follow symlinks found while walking
+	binary      bool // process binary files, rather than skipping them
+	noIgnore    bool // don't honor ignore files
+
+	includes    globList // only process files whose name matches any of these
+	excludes    globList // skip files whose name matches any of these
+	excludeDirs globList // don't descend into directories whose name matches any of these
+
+	// decoded files (e.g. compressed files or archives) aren't skipped as
+	// binary, since they'll be decoded once added
+	decoded func(f *os.File) bool
+
+	done <-chan struct{}
+	add  func(*os.File, error)
+
+	// warn is called with any error reading a directory, or an ignore file
+	// within one, which is then skipped (or not honored) rather than stopping
+	// the walk; any error with the root itself, or a file found, is added.
+	warn func(error)
+}
+
+// readDir lists a directory while walking; a variable so that tests may
+// inject errors.
+var readDir = ioutil.ReadDir
+
+// walk adds every file found under the given root, or the root itself if
+// it's not a directory; it returns false if the walker's done channel was
+// closed before finishing.
+func (w *walker) walk(root string) bool {
+	info, err := os.Stat(root)
+	if err != nil {
+		w.add(nil, err)
+		return !w.stopped()
+	}
+	if !info.IsDir() {
+		w.add(os.Open(root))
+		return !w.stopped()
+	}
+	return w.walkDir(root, info, nil, nil)
+}
+
+func (w *walker) stopped() bool {
+	select {
+	case <-w.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *walker) walkDir(dir string, info os.FileInfo, ancestors []os.FileInfo, rules ignoreRules) bool {
+	for _, anc := range ancestors {
+		if os.SameFile(anc, info) {
+			// symlink loop
+			return true
+		}
+	}
+	ancestors = append(ancestors, info)
+
+	if !w.noIgnore {
+		for _, name := range ignoreFileNames {
+			more, err := readIgnoreFile(dir, name)
+			if err != nil {
+				w.warn(err)
+				continue
+			}
+			rules = append(rules[:len(rules):len(rules)], more...)
+		}
+	}
+
+	ents, err := readDir(dir)
+	if err != nil {
+		w.warn(err)
+		return !w.stopped()
+	}
+	for _, ent := range ents {
+		if w.stopped() {
+			return false
+		}
+		name := ent.Name()
+		p := filepath.Join(dir, name)
+
+		if ent.Mode()&os.ModeSymlink != 0 {
+			if !w.followLinks {
+				continue
+			}
+			if ent, err = os.Stat(p); err != nil {
+				// dangling link
+				continue
+			}
+		}
+
+		switch {
+		case ent.IsDir():
+			if !w.noIgnore && name == ".git" {
+				continue
+			}
+			if w.excludeDirs.match(name) || rules.ignored(p, true) {
+				continue
+			}
+			if !w.walkDir(p, ent, ancestors, rules) {
+				return false
+			}
+
+		case ent.Mode().IsRegular():
+			if len(w.includes) > 0 && !w.includes.match(name) {
+				continue
+			}
+			if w.excludes.match(name) || rules.ignored(p, false) {
+				continue
+			}
+			w.addFile(p)
+		}
+	}
+	return true
+}
+
+func (w *walker) addFile(name string) {
+	f, err := os.Open(name)
+	if err == nil && !w.binary && (w.decoded == nil || !w.decoded(f)) {
+		var isBin bool
+		if isBin, err = isBinary(f); err == nil && isBin {
+			_ = f.Close()
+			return
+		}
+	}
+	if err != nil && f != nil {
+		_ = f.Close()
+		f = nil
+	}
+	w.add(f, err)
+}
+
+// isBinary sniffs the start of the given file for NUL bytes, and then seeks
+// back to its start.
+func isBinary(f *os.File) (bool, error) {
+	var buf [binarySniffLen]byte
+	n, err := io.ReadFull(f, buf[:])
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	return bytes.IndexByte(buf[:n], 0) >= 0, err
+}
+
+// globList is a list of filepath.Match patterns, settable as a repeated
+// command line flag.
+type globList []string
+
+func (gl globList) String() string { return strings.Join(gl, ",") }
+
+func (gl *globList) Set(s string) error {
+	if _, err := filepath.Match(s, ""); err != nil {
+		return err
+	}
+	*gl = append(*gl, s)
+	return nil
+}
+
+func (gl globList) match(name string) bool {
+	for _, pat := range gl {
+		if ok, _ := filepath.Match(pat, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoreRule is a single pattern line from a gitignore-style file.
+type ignoreRule struct {
+	dir      string // directory containing the ignore file
+	pattern  string
+	negate   bool // pattern started with "!"
+	dirOnly  bool // pattern ended with "/"
+	anchored bool // pattern contained a "/", so is matched against the whole path under dir
+}
+
+// ignoreRules are applied in order, so that later rules (e.g. from deeper
+// ignore files) override earlier ones.
+type ignoreRules []ignoreRule
+
+func readIgnoreFile(dir, name string) (ignoreRules, error) {
+	f, err := os.Open(filepath.Join(dir, name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var rules ignoreRules
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if rule, ok := parseIgnoreRule(dir, sc.Text()); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, sc.Err()
+}
+
+func parseIgnoreRule(dir, line string) (rule ignoreRule, ok bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || line[0] == '#' {
+		return rule, false
+	}
+	rule.dir = dir
+	if line[0] == '!' {
+		rule.negate = true
+		line = line[1:]
+	} else if line[0] == '\\' {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.HasPrefix(line, "**/") {
+		line = line[3:]
+	}
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	rule.pattern = line
+	return rule, line != ""
+}
+
+func (rules ignoreRules) ignored(name string, isDir bool) bool {
+	ignored := false
+	for _, rule := range rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.match(name) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+func (rule ignoreRule) match(name string) bool {
+	rel, err := filepath.Rel(rule.dir, name)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	if !rule.anchored {
+		ok, _ := path.Match(rule.pattern, path.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(rule.pattern, "/"), strings.Split(rel, "/"))
+}
+
+// matchSegments matches path segments against pattern segments, where a
+// "**" pattern segment matches zero or more path segments.
+func matchSegments(pats, segs []string) bool {
+	for len(pats) > 0 {
+		if pats[0] == "**" {
+			for i := 0; i <= len(segs); i++ {
+				if matchSegments(pats[1:], segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pats[0], segs[0]); !ok {
+			return false
+		}
+		pats, segs = pats[1:], segs[1:]
+	}
+	return len(segs) == 0
+}
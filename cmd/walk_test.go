@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ignoreRules(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		lines []string
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{name: "base name", lines: []string{"*.log"}, path: "/r/a.log", want: true},
+		{name: "base name in subdir", lines: []string{"*.log"}, path: "/r/sub/a.log", want: true},
+		{name: "no match", lines: []string{"*.log"}, path: "/r/a.txt", want: false},
+		{name: "comment", lines: []string{"#a.txt"}, path: "/r/#a.txt", want: false},
+		{name: "escaped", lines: []string{`\#a.txt`}, path: "/r/#a.txt", want: true},
+
+		{name: "negated", lines: []string{"*.log", "!keep.log"}, path: "/r/keep.log", want: false},
+		{name: "negation keeps others", lines: []string{"*.log", "!keep.log"}, path: "/r/drop.log", want: true},
+		{name: "negation overridden", lines: []string{"!keep.log", "*.log"}, path: "/r/keep.log", want: true},
+
+		{name: "anchored", lines: []string{"/build"}, path: "/r/build", isDir: true, want: true},
+		{name: "anchored not in subdir", lines: []string{"/build"}, path: "/r/sub/build", isDir: true, want: false},
+		{name: "anchored by inner slash", lines: []string{"doc/*.txt"}, path: "/r/doc/a.txt", want: true},
+		{name: "anchored by inner slash not in subdir", lines: []string{"doc/*.txt"}, path: "/r/sub/doc/a.txt", want: false},
+
+		{name: "leading double star", lines: []string{"**/foo"}, path: "/r/a/b/foo", want: true},
+		{name: "inner double star", lines: []string{"a/**/b"}, path: "/r/a/x/y/b", want: true},
+		{name: "inner double star matching none", lines: []string{"a/**/b"}, path: "/r/a/b", want: true},
+		{name: "inner double star anchored", lines: []string{"a/**/b"}, path: "/r/c/a/b", want: false},
+		{name: "trailing double star", lines: []string{"logs/**"}, path: "/r/logs/x/y.txt", want: true},
+
+		{name: "dir only dir", lines: []string{"tmp/"}, path: "/r/tmp", isDir: true, want: true},
+		{name: "dir only file", lines: []string{"tmp/"}, path: "/r/tmp", want: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var rules ignoreRules
+			for _, line := range tc.lines {
+				if rule, ok := parseIgnoreRule("/r", line); ok {
+					rules = append(rules, rule)
+				}
+			}
+			assert.Equal(t, tc.want, rules.ignored(tc.path, tc.isDir), "expected %q ignored under %q", tc.path, tc.lines)
+		})
+	}
+}
+
+func Test_walker(t *testing.T) {
+	root, err := ioutil.TempDir("", "walk")
+	require.NoError(t, err, "unexpected tempdir error")
+	defer func() { _ = os.RemoveAll(root) }()
+
+	for name, content := range map[string]string{
+		"a.txt":             "a\n",
+		"bin.dat":           "a\x00b",
+		"bin.gz":            "\x1f\x8b\x00",
+		"debug.log":         "log\n",
+		".gitignore":        "*.log\n/build/\n",
+		"build/out.txt":     "out\n",
+		"sub/build/in.txt":  "in\n",
+		"sub/keep.log":      "keep\n",
+		"sub/.ignore":       "!keep.log\n",
+		".git/config":       "git\n",
+		"bad/.ignore/x":     "not a file\n",
+		"bad/b.txt":         "b\n",
+		"bad/b.log":         "still ignored\n",
+		"sub/deep/drop.log": "drop\n",
+	} {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, ioutil.WriteFile(p, []byte(content), 0644))
+	}
+
+	var (
+		added []string
+		warns []error
+	)
+	w := walker{
+		decoded: func(f *os.File) bool { return strings.HasSuffix(f.Name(), ".gz") },
+		done:    make(chan struct{}),
+		add: func(f *os.File, err error) {
+			if assert.NoError(t, err, "unexpected input error") {
+				rel, _ := filepath.Rel(root, f.Name())
+				added = append(added, filepath.ToSlash(rel))
+				_ = f.Close()
+			}
+		},
+		warn: func(err error) { warns = append(warns, err) },
+	}
+	assert.True(t, w.walk(root), "expected walk to finish")
+	sort.Strings(added)
+	assert.Equal(t, []string{
+		".gitignore",
+		"a.txt",
+		"bad/.ignore/x",
+		"bad/b.txt",
+		"bin.gz",
+		"sub/.ignore",
+		"sub/build/in.txt",
+		"sub/keep.log",
+	}, added, "expected walked files")
+	if assert.Len(t, warns, 1, "expected unreadable ignore file error") {
+		assert.Contains(t, warns[0].Error(), filepath.Join("bad", ".ignore"))
+	}
+
+	t.Run("unreadable dir", func(t *testing.T) {
+		defer func(prior func(string) ([]os.FileInfo, error)) { readDir = prior }(readDir)
+		bang := errors.New("bang")
+		readDir = func(dir string) ([]os.FileInfo, error) {
+			if filepath.Base(dir) == "sub" {
+				return nil, bang
+			}
+			return ioutil.ReadDir(dir)
+		}
+		added, warns = nil, nil
+		assert.True(t, w.walk(root), "expected walk to finish")
+		sort.Strings(added)
+		assert.Equal(t, []string{
+			".gitignore",
+			"a.txt",
+			"bad/.ignore/x",
+			"bad/b.txt",
+			"bin.gz",
+		}, added, "expected walked files")
+		if assert.Len(t, warns, 2, "expected errors") {
+			assert.Contains(t, warns[0].Error(), filepath.Join("bad", ".ignore"))
+			assert.Equal(t, bang, warns[1], "expected unreadable dir error")
+		}
+	})
+
+	t.Run("binary", func(t *testing.T) {
+		added = nil
+		w.binary = true
+		assert.True(t, w.walk(root), "expected walk to finish")
+		assert.Contains(t, added, "bin.dat", "expected binary file")
+	})
+
+	t.Run("no ignore", func(t *testing.T) {
+		added = nil
+		w.noIgnore = true
+		assert.True(t, w.walk(root), "expected walk to finish")
+		assert.Contains(t, added, "debug.log", "expected ignored file")
+		assert.Contains(t, added, "sub/deep/drop.log", "expected ignored file")
+		assert.Contains(t, added, ".git/config", "expected .git file")
+	})
+}
@@ -2,6 +2,7 @@ package xre
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -33,7 +34,13 @@ type Command interface {
 // the given channel, which are then closed after processing is done. It is a
 // convenience around ParseCommand and BuildReaderFrom. The given environment
 // is closed before returning.
-func RunCommand(prog string, env Environment) (rerr error) {
+func RunCommand(prog string, env Environment) error {
+	return RunCommandContext(context.Background(), prog, env)
+}
+
+// RunCommandContext is like RunCommand, but stops processing early once the
+// given context is done; see RunReaderFromContext.
+func RunCommandContext(ctx context.Context, prog string, env Environment) (rerr error) {
 	defer func() {
 		if cerr := env.Close(); rerr == nil {
 			rerr = cerr
@@ -47,26 +54,123 @@ func RunCommand(prog string, env Environment) (rerr error) {
 	if err != nil {
 		return err
 	}
-	return RunReaderFrom(rf, env)
+	return RunReaderFromContext(ctx, rf, env)
 }
 
 // RunReaderFrom runs the given io.ReaderFrom over all inputs received from
 // env.Inputs(). Each input reader is closed after having read from it.
-// Processing stops on the first input, read, or close error, which is returned.
+// Processing stops on the first input, read, or close error, which is returned;
+// unless the environment handles input errors itself, e.g. FileEnv.KeepGoing.
 func RunReaderFrom(rf io.ReaderFrom, env Environment) error {
-	for in := range env.Inputs() {
-		if in.Err != nil {
-			return in.Err
+	return RunReaderFromContext(context.Background(), rf, env)
+}
+
+// RunReaderFromContext is like RunReaderFrom, but also stops once the given
+// context is done, returning its error. The context is checked before
+// receiving each input, and before every read from within an input.
+func RunReaderFromContext(ctx context.Context, rf io.ReaderFrom, env Environment) error {
+	var handle func(error) error
+	if ieh, ok := env.(inputErrorHandler); ok {
+		handle = ieh.handleInputErrors()
+	}
+	obs, _ := env.(inputObserver)
+	ins := env.Inputs()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var in Input
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case recv, ok := <-ins:
+			if !ok {
+				return nil
+			}
+			in = recv
 		}
-		_, err := rf.ReadFrom(in.ReadCloser)
-		if cerr := in.ReadCloser.Close(); err == nil {
-			err = cerr
+		isInput, err := readInput(ctx, rf, in, handle != nil)
+		if isInput && handle != nil {
+			err = handle(inputError(inputName(in), err))
+		} else if err == nil && obs != nil {
+			err = obs.inputDone(inputName(in))
 		}
 		if err != nil {
 			return err
 		}
 	}
-	return nil
+}
+
+// inputErrorHandler may be implemented by an Environment to continue past
+// errors with individual inputs: if it returns a non-nil handler, that's called
+// with any such error instead, and processing only stops if it returns non-nil.
+type inputErrorHandler interface {
+	handleInputErrors() func(error) error
+}
+
+// readInput runs rf over the given input, returning any error, and closes it.
+// Regular file inputs are memory mapped and processed whole if rf is also a
+// Processor (see mappedProcessor and MmapLimit).
+// If classify is true, isInput reports whether that error was with the input
+// itself (acquiring, reading, or closing it) rather than with processing.
+func readInput(ctx context.Context, rf io.ReaderFrom, in Input, classify bool) (isInput bool, err error) {
+	if in.Err != nil {
+		return true, in.Err
+	}
+	if proc, isProc := mappedProcessor(rf); isProc {
+		if err := ctx.Err(); err != nil {
+			_ = in.ReadCloser.Close()
+			return false, err
+		}
+		if mapped, err := processMapped(in.ReadCloser, proc); mapped {
+			if cerr := in.ReadCloser.Close(); err == nil {
+				return cerr != nil, cerr
+			}
+			return false, err
+		}
+	}
+	var r io.Reader = in.ReadCloser
+	var ir *inputReader
+	if classify {
+		ir = &inputReader{r: r}
+		r = ir
+	}
+	if ctx.Done() != nil {
+		r = ctxReader{ctx, r}
+	}
+	_, err = rf.ReadFrom(r)
+	if cerr := in.ReadCloser.Close(); err == nil {
+		return cerr != nil, cerr
+	}
+	return ir != nil && ir.err != nil && errors.Is(err, ir.err), err
+}
+
+// inputReader records any read error, other than io.EOF.
+type inputReader struct {
+	r   io.Reader
+	err error
+}
+
+func (ir *inputReader) Read(p []byte) (int, error) {
+	n, err := ir.r.Read(p)
+	if err != nil && err != io.EOF {
+		ir.err = err
+	}
+	return n, err
+}
+
+// ctxReader fails any read once its context is done; it cannot interrupt a
+// read that is already blocked, but does stop any further progress.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr ctxReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
 }
 
 // ProtoCommand implements Command around a ProtoProcessor; it's the simplest
@@ -145,16 +249,36 @@ func createProcessor(cmd Command, env Environment) (Processor, error) {
 // Environment doesn't provide any default reader semantics, then an error is
 // returned telling the user to specify match extraction semantics (e.g. line
 // delimiting by adding a `y/\n/` prefix to the command).
+//
+// If the Environment's output may be consumed live (e.g. a FileEnv writing to
+// a terminal under BufferStructure), then it's flushed whenever processing
+// would wait on more input; if it wants processing to be eager (see
+// FileEnv.Eager), then each token extracted by the head command is processed
+// as soon as it's complete, rather than when the next one is found.
 func BuildReaderFrom(cmd Command, env Environment) (io.ReaderFrom, error) {
+	var (
+		eager bool
+		flush func() error
+	)
+	if sf, ok := env.(structureFlusher); ok {
+		eager, flush = sf.structureFlush()
+	}
 	proc, err := createProcessor(cmd, env)
 	if err != nil {
 		return nil, err
 	}
-	if rf, canReadFrom := proc.(io.ReaderFrom); canReadFrom {
-		return rf, nil
+	if mp, isMatch := proc.(*matchProcessor); isMatch {
+		mp.eager = eager
+	}
+	rf, canReadFrom := proc.(io.ReaderFrom)
+	if !canReadFrom {
+		// TODO scrap this adaptor, it's insane
+		rf = procIOAdaptor{Processor: proc}
+	}
+	if flush != nil {
+		rf = flushReaderFrom{rf, flush}
 	}
-	// TODO scrap this adaptor, it's insane
-	return procIOAdaptor{Processor: proc}, nil
+	return rf, nil
 }
 
 type procIOAdaptor struct {
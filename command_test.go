@@ -2,10 +2,12 @@ package xre_test
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"strings"
 	"testing"
+	"testing/iotest"
 	"unicode"
 
 	"github.com/jcorbin/xre"
@@ -83,6 +85,14 @@ func (rf _readFixture) Reader() io.Reader {
 	return &_fixedReader{append([]_readFix(nil), rf...)}
 }
 
+// oneByteAtATime is a test input read a single byte at a time, so that every
+// token ends some read.
+type oneByteAtATime []byte
+
+func (ob oneByteAtATime) Reader() io.Reader {
+	return iotest.OneByteReader(bytes.NewReader(ob))
+}
+
 func (fr *_fixedReader) Read(b []byte) (n int, err error) {
 	if len(fr.fs) == 0 {
 		return 0, io.EOF
@@ -105,6 +115,41 @@ func (fr *_fixedReader) Read(b []byte) (n int, err error) {
 
 type cmdTestCases []cmdTestCase
 
+func TestRunReaderFromContext(t *testing.T) {
+	defer func(prior int) { xre.MinRead = prior }(xre.MinRead)
+	xre.MinRead = 4
+
+	cmd, err := xre.ParseCommand(`y"\n" p"\n"`)
+	require.NoError(t, err, "unexpected parse error")
+
+	var be xre.BufEnv
+	rf, err := xre.BuildReaderFrom(cmd, &be)
+	require.NoError(t, err, "unexpected build error")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	be.SetInputs(
+		cancelReader{strings.NewReader("aaa\nbbb\nccc\n"), cancel},
+		strings.NewReader("ddd\n"),
+	)
+	err = xre.RunReaderFromContext(ctx, rf, &be)
+	assert.Equal(t, context.Canceled, err, "expected cancellation error")
+	assert.Equal(t, "aaa\n", be.DefaultOutput.String(), "expected output up to cancellation")
+}
+
+// cancelReader cancels its context after its first read.
+type cancelReader struct {
+	io.Reader
+	cancel context.CancelFunc
+}
+
+func (cr cancelReader) Read(p []byte) (n int, err error) {
+	n, err = cr.Reader.Read(p)
+	cr.cancel()
+	return n, err
+}
+
 func (tcs cmdTestCases) run(t *testing.T) {
 	var te testEnv
 	for _, tc := range tcs {
@@ -0,0 +1,65 @@
+package xre
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrQuit is returned by processing under a Quiet FileEnv once the first
+// structure would have been written; it means success, not failure.
+var ErrQuit = errors.New("quit after first output")
+
+// CountMode controls whether a FileEnv counts output structures, rather than
+// writing them.
+type CountMode int
+
+const (
+	// CountNone writes output structures normally.
+	CountNone CountMode = iota
+
+	// CountTotal writes only the total number of output structures, once
+	// processing is done.
+	CountTotal
+
+	// CountPerInput writes the number of output structures after each
+	// input, as "name:count".
+	CountPerInput
+)
+
+func (cm CountMode) String() string {
+	switch cm {
+	case CountNone:
+		return "none"
+	case CountTotal:
+		return "total"
+	case CountPerInput:
+		return "per-input"
+	default:
+		return fmt.Sprintf("CountMode(%d)", int(cm))
+	}
+}
+
+// outputStats counts how many (non-nil) structures have been written through
+// a writer; if quit is set, writing any structure fails with ErrQuit instead.
+type outputStats struct {
+	n    int
+	quit bool
+}
+
+// add counts n more structures; a nil outputStats counts nothing.
+func (st *outputStats) add(n int) error {
+	if st == nil || n == 0 {
+		return nil
+	}
+	st.n += n
+	if st.quit {
+		return ErrQuit
+	}
+	return nil
+}
+
+// inputObserver may be implemented by an Environment to be told after each
+// input has been processed, and its output written.
+type inputObserver interface {
+	inputDone(name string) error
+}
@@ -0,0 +1,272 @@
+package xre
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+var errCSVQuote = errors.New("unterminated quoted csv field")
+
+// betweenCSV extracts each record from CSV (RFC 4180) content, with quoted
+// fields possibly containing separators, newlines, or doubled quotes; records
+// are extracted raw, without their line terminator, and blank lines are
+// skipped.
+type betweenCSV struct{ sep string }
+
+// extractCSV extracts the unquoted fields of each CSV record, or only those in
+// a single column, selected either by (1-based) index or by name, looked up in
+// a header record at the start of each input.
+type extractCSV struct {
+	sep  string
+	col  int
+	name string
+}
+
+// csvFields is the state of an extractCSV processor.
+type csvFields struct {
+	extractCSV
+	fields [][2]int
+	col    int // resolved column index (0-based), -1 for all fields
+	header bool
+}
+
+func scanYC(s string) (Command, string, error) {
+	sep, s, err := scanCSVSep(s)
+	if err != nil {
+		return nil, s, err
+	}
+	return ProtoCommand{betweenCSV{sep}}, s, nil
+}
+
+func scanXC(s string) (Command, string, error) {
+	sep, s, err := scanCSVSep(s)
+	if err != nil {
+		return nil, s, err
+	}
+	xc := extractCSV{sep: sep}
+	if len(s) == 0 || s[0] != ':' {
+		return ProtoCommand{xc}, s, nil
+	}
+	s = s[1:]
+	if len(s) > 0 && s[0] == '"' {
+		name, rest, err := scanString(s[0], s[1:])
+		if err == nil && name == "" {
+			err = errors.New("empty csv column name")
+		}
+		xc.name = name
+		return ProtoCommand{xc}, rest, err
+	}
+	col, rest, err := scanInt(s)
+	if err == nil && (rest == s || col < 1) {
+		err = errors.New("expected csv column number or name after :")
+	}
+	xc.col = col
+	return ProtoCommand{xc}, rest, err
+}
+
+func scanCSVSep(s string) (string, string, error) {
+	if len(s) == 0 || s[0] != '"' {
+		return ",", s, nil
+	}
+	sep, s, err := scanString(s[0], s[1:])
+	if err != nil {
+		return sep, s, err
+	}
+	if sep == "" || bytes.ContainsAny([]byte(sep), "\"\r\n") {
+		return sep, s, fmt.Errorf("invalid csv separator %q", sep)
+	}
+	return sep, s, nil
+}
+
+func (yc betweenCSV) String() string { return "yc" + csvSepSpec(yc.sep) }
+
+func (xc extractCSV) String() string {
+	s := "xc" + csvSepSpec(xc.sep)
+	if xc.name != "" {
+		s += ":" + stringSpec(xc.name)
+	} else if xc.col > 0 {
+		s += ":" + strconv.Itoa(xc.col)
+	}
+	return s
+}
+
+func csvSepSpec(sep string) string {
+	if sep == "," {
+		return ""
+	}
+	return stringSpec(sep)
+}
+
+func (yc betweenCSV) Create(next Processor) Processor {
+	return &matchProcessor{next: next, matcher: yc}
+}
+
+func (xc extractCSV) Create(next Processor) Processor {
+	cf := &csvFields{extractCSV: xc}
+	cf.reset()
+	return &matchProcessor{next: next, matcher: cf}
+}
+
+func (yc betweenCSV) match(mp *matchProcessor, buf []byte) error {
+	_, end, next, found, err := scanCSVRecord(buf, yc.sep, mp.buf.Err() == io.EOF, nil)
+	if !found {
+		return err
+	}
+	if end == 0 {
+		if err := mp.procPrior(false); err != nil {
+			return err
+		}
+		mp.buf.Advance(next)
+		return nil
+	}
+	return mp.pushLoc(0, end, next)
+}
+
+// reset forgets any header record, so that the next one processed is taken
+// as a new header.
+func (cf *csvFields) reset() {
+	cf.header = false
+	cf.col = cf.extractCSV.col - 1
+}
+
+// match processes the selected fields of the next record in buf directly,
+// rather than through pushLoc, since unquoted fields aren't slices of buf.
+func (cf *csvFields) match(mp *matchProcessor, buf []byte) error {
+	fields, end, next, found, err := scanCSVRecord(buf, cf.sep, mp.buf.Err() == io.EOF, cf.fields[:0])
+	cf.fields = fields
+	if !found {
+		return err
+	}
+	if err := mp.procPrior(false); err != nil {
+		return err
+	}
+	if end > 0 {
+		err = cf.yieldFields(mp, buf)
+	}
+	mp.buf.Advance(next)
+	return err
+}
+
+func (cf *csvFields) yieldFields(mp *matchProcessor, buf []byte) error {
+	if cf.name != "" && !cf.header {
+		cf.header = true
+		for i, loc := range cf.fields {
+			if string(csvFieldValue(buf[loc[0]:loc[1]])) == cf.name {
+				cf.col = i
+				return nil
+			}
+		}
+		return fmt.Errorf("csv column %q not found", cf.name)
+	}
+	if cf.col >= 0 {
+		if cf.col < len(cf.fields) {
+			loc := cf.fields[cf.col]
+			return mp.yield(csvFieldValue(buf[loc[0]:loc[1]]), false)
+		}
+		return nil
+	}
+	for _, loc := range cf.fields {
+		if err := mp.yield(csvFieldValue(buf[loc[0]:loc[1]]), false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanCSVRecord scans the record at the start of buf, appending the raw
+// location of each of its fields to fields; it returns the end of the record,
+// excluding any line terminator, and the offset of the next record. The record
+// is only found once its terminator has been, unless atEOF.
+//
+// Like encoding/csv with LazyQuotes, a quote within an unquoted field is taken
+// literally, as is any content after a quoted field's closing quote.
+func scanCSVRecord(buf []byte, sep string, atEOF bool, fields [][2]int) (_ [][2]int, end, next int, found bool, err error) {
+	for off := 0; ; {
+		start := off
+		if off < len(buf) && buf[off] == '"' {
+			for off++; ; {
+				i := bytes.IndexByte(buf[off:], '"')
+				if i < 0 {
+					if atEOF {
+						err = errCSVQuote
+					}
+					return fields, 0, 0, false, err
+				}
+				off += i + 1
+				if off == len(buf) && !atEOF {
+					// may yet be a doubled quote
+					return fields, 0, 0, false, nil
+				}
+				if off < len(buf) && buf[off] == '"' {
+					off++
+					continue
+				}
+				break
+			}
+		}
+		i := indexCSVEnd(buf[off:], sep)
+		if i < 0 {
+			if !atEOF {
+				return fields, 0, 0, false, nil
+			}
+			fields = append(fields, [2]int{start, len(buf)})
+			return fields, len(buf), len(buf), true, nil
+		}
+		off += i
+		if buf[off] != '\n' {
+			fields = append(fields, [2]int{start, off})
+			off += len(sep)
+			continue
+		}
+		end = off
+		if end > start && buf[end-1] == '\r' {
+			end--
+		}
+		fields = append(fields, [2]int{start, end})
+		return fields, end, off + 1, true, nil
+	}
+}
+
+// indexCSVEnd returns the index of the first separator or newline in buf, or
+// -1 if there's neither.
+func indexCSVEnd(buf []byte, sep string) int {
+	for i, c := range buf {
+		if c == '\n' || c == sep[0] && bytes.HasPrefix(buf[i:], []byte(sep)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// csvFieldValue returns the unquoted value of a raw CSV field.
+func csvFieldValue(raw []byte) []byte {
+	if len(raw) == 0 || raw[0] != '"' {
+		return raw
+	}
+	raw = raw[1:]
+	i := bytes.IndexByte(raw, '"')
+	if i == len(raw)-1 {
+		return raw[:i]
+	}
+	val := make([]byte, 0, len(raw))
+	for len(raw) > 0 {
+		if i < 0 {
+			return append(val, raw...)
+		}
+		val = append(val, raw[:i]...)
+		raw = raw[i+1:]
+		if len(raw) > 0 && raw[0] == '"' {
+			// doubled quote
+			val = append(val, '"')
+			raw = raw[1:]
+		} else {
+			// closing quote, any remainder is literal
+			return append(val, raw...)
+		}
+		i = bytes.IndexByte(raw, '"')
+	}
+	return val
+}
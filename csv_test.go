@@ -0,0 +1,69 @@
+package xre_test
+
+import "testing"
+
+var csvData = []byte("name,note,n\r\n" +
+	`alice,"says ""hi"", then` + "\n" + `leaves",1` + "\n" +
+	"\n" +
+	"bob,plain,2\n" +
+	`"carol",x"y,3`)
+
+func Test_csv(t *testing.T) {
+	cmdTestCases{
+		{name: "records",
+			cmd: `yc p%"%q\n"`,
+			in:  csvData,
+			out: []byte(`"name,note,n"
+"alice,\"says \"\"hi\"\", then\nleaves\",1"
+"bob,plain,2"
+"\"carol\",x\"y,3"
+`),
+		},
+		{name: "fields",
+			cmd: `xc p%"%q\n"`,
+			in:  csvData,
+			out: []byte(`"name"
+"note"
+"n"
+"alice"
+"says \"hi\", then\nleaves"
+"1"
+"bob"
+"plain"
+"2"
+"carol"
+"x\"y"
+"3"
+`),
+		},
+		{name: "column by index",
+			cmd: `xc:2 p%"%q\n"`,
+			in:  csvData,
+			out: []byte(`"note"
+"says \"hi\", then\nleaves"
+"plain"
+"x\"y"
+`),
+		},
+		{name: "column by name",
+			cmd: `xc:"n" p"\n"`,
+			in:  csvData,
+			out: []byte("1\n2\n3\n"),
+		},
+		{name: "fields of records",
+			cmd: `yc g/^b/ xc p"|"`,
+			in:  csvData,
+			out: []byte("bob|plain|2|"),
+		},
+		{name: "tab separated",
+			cmd: `xc"\t":"b" p"\n"`,
+			in:  []byte("a\tb\n1\t\"2\t3\"\n4\t5\n"),
+			out: []byte("2\t3\n5\n"),
+		},
+		{name: "multi-byte separator",
+			cmd: `yc"||" xc"||":2 p"\n"`,
+			in:  []byte("a||b|c||d\n"),
+			out: []byte("b|c\n"),
+		},
+	}.run(t)
+}
@@ -0,0 +1,136 @@
+package xre
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// zlibSniffSize is how much of a plausible zlib stream is decoded before
+// trusting it to be one.
+const zlibSniffSize = 64 << 10
+
+// Decompress sniffs the leading magic bytes of the given stream, returning a
+// stream that transparently decodes it if it's gzip, bzip2, zlib, or
+// compress(1) LZW data; any other stream is returned (in effect) as is.
+//
+// The returned stream retains any Name() of the given one (e.g. an *os.File),
+// attributes any decoding error to that name, and closes the given stream when
+// closed.
+func Decompress(rc io.ReadCloser) (io.ReadCloser, error) {
+	dc := &decompressor{
+		src:  rc,
+		br:   bufio.NewReaderSize(rc, zlibSniffSize),
+		name: inputName(Input{rc, nil}),
+	}
+	magic, err := dc.br.Peek(4)
+	if err == io.EOF {
+		err = nil
+	} else if err != nil {
+		_ = rc.Close()
+		return nil, inputError(dc.name, err)
+	}
+	dc.Reader = dc.br
+	switch {
+	case isGzipMagic(magic):
+		var zr *gzip.Reader
+		zr, err = gzip.NewReader(dc.br)
+		dc.Reader, dc.dec = zr, zr
+	case isBzip2Magic(magic):
+		dc.Reader = bzip2.NewReader(dc.br)
+	case isLZWMagic(magic):
+		dc.Reader, err = newUnixLZWReader(dc.br)
+	case isZlibHeader(magic) && dc.sniffZlib():
+		var zr io.ReadCloser
+		zr, err = zlib.NewReader(dc.br)
+		dc.Reader, dc.dec = zr, zr
+	}
+	if err != nil {
+		_ = rc.Close()
+		return nil, inputError(dc.name, err)
+	}
+	return dc, nil
+}
+
+// SniffCompressed returns true if the given file starts with the magic bytes
+// of gzip, bzip2 or compress(1) data, without reading from its current offset;
+// it's false for anything that can't be read at an offset, like a pipe. Since
+// the zlib header is also plausible text, and can only be trusted once decoded,
+// zlib data is only recognized by Decompress itself.
+func SniffCompressed(f *os.File) bool {
+	var magic [4]byte
+	n, _ := f.ReadAt(magic[:], 0)
+	m := magic[:n]
+	return isGzipMagic(m) || isBzip2Magic(m) || isLZWMagic(m)
+}
+
+func isGzipMagic(magic []byte) bool { return bytes.HasPrefix(magic, []byte{0x1f, 0x8b}) }
+func isLZWMagic(magic []byte) bool  { return bytes.HasPrefix(magic, []byte{0x1f, 0x9d}) }
+
+func isBzip2Magic(magic []byte) bool {
+	return bytes.HasPrefix(magic, []byte("BZh")) &&
+		len(magic) > 3 && '1' <= magic[3] && magic[3] <= '9'
+}
+
+// isZlibHeader returns true if the given bytes start with a zlib header as
+// written by common encoders: deflate with a 32K window, no preset dictionary,
+// and any of the 4 compression level hints. Since these are also plausible
+// text, like "x^", a stream must also pass sniffZlib.
+func isZlibHeader(magic []byte) bool {
+	if len(magic) < 2 || magic[0] != 0x78 {
+		return false
+	}
+	switch magic[1] {
+	case 0x01, 0x5e, 0x9c, 0xda:
+		return true
+	default:
+		return false
+	}
+}
+
+// sniffZlib returns true if the start of the stream decodes as zlib data
+// without error, including its checksum if the stream ends within it.
+func (dc *decompressor) sniffZlib() bool {
+	head, _ := dc.br.Peek(zlibSniffSize)
+	zr, err := zlib.NewReader(bytes.NewReader(head))
+	if err != nil {
+		return false
+	}
+	_, err = io.Copy(ioutil.Discard, zr)
+	return err == nil || err == io.ErrUnexpectedEOF && len(head) == zlibSniffSize
+}
+
+type decompressor struct {
+	io.Reader
+	src  io.ReadCloser
+	br   *bufio.Reader
+	dec  io.Closer
+	name string
+}
+
+// Name returns the name of the underlying compressed stream, if any.
+func (dc *decompressor) Name() string { return dc.name }
+
+func (dc *decompressor) Read(p []byte) (int, error) {
+	n, err := dc.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		err = inputError(dc.name, err)
+	}
+	return n, err
+}
+
+func (dc *decompressor) Close() error {
+	var err error
+	if dc.dec != nil {
+		err = dc.dec.Close()
+	}
+	if cerr := dc.src.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
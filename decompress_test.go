@@ -0,0 +1,235 @@
+package xre_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jcorbin/xre"
+)
+
+// compressLZW implements enough of compress(1) to produce test inputs; when
+// clear is set, the table is cleared whenever it fills up, rather than based on
+// compression ratio. Its output (for maxBits of at least 10) was checked to
+// decode the same under gzip -d.
+func compressLZW(data []byte, maxBits uint, clear bool) []byte {
+	out := []byte{0x1f, 0x9d, byte(maxBits) | 0x80}
+	var (
+		acc   uint64
+		nacc  uint
+		since uint
+	)
+	write := func(code int, n uint) {
+		acc |= uint64(code) << nacc
+		nacc += n
+		since += n
+		for nacc >= 8 {
+			out = append(out, byte(acc))
+			acc >>= 8
+			nacc -= 8
+		}
+	}
+	align := func(n uint) {
+		group := n * 8
+		write(0, (group-since%group)%group)
+		since = 0
+	}
+	if len(data) == 0 {
+		return out
+	}
+	type key struct {
+		ent int
+		c   byte
+	}
+	nBits, maxMax, free := uint(9), 1<<maxBits, 257
+	table := make(map[key]int)
+	ent := int(data[0])
+	for _, c := range data[1:] {
+		k := key{ent, c}
+		if code, ok := table[k]; ok {
+			ent = code
+			continue
+		}
+		write(ent, nBits)
+		ent = int(c)
+		if free < maxMax {
+			table[k] = free
+			free++
+		} else if clear {
+			write(256, nBits)
+			align(nBits)
+			table = make(map[key]int)
+			nBits, free = 9, 257
+			continue
+		}
+		if free > 1<<nBits && nBits < maxBits {
+			align(nBits)
+			nBits++
+		}
+	}
+	write(ent, nBits)
+	if nacc > 0 {
+		out = append(out, byte(acc))
+	}
+	return out
+}
+
+// lzwFixture is a short .Z stream, also checked under gzip -d, that pins the
+// decoder against any matching change in compressLZW.
+var lzwFixture = []byte("\x1f\x9d\x90\x54\x9e\x08\x29\xf2\x44\x8a\x93\x27\x54\x02\x0e\x2c\xa8\x90\xa0\x41\x84\x23\x14\x00")
+
+func decompressTestInput() []byte {
+	var buf bytes.Buffer
+	words := strings.Fields("the quick brown fox jumps over a lazy dog with structural regular expressions")
+	for i := 0; i < 5000; i++ {
+		buf.WriteString(words[(i*i+i/3)%len(words)])
+		if i%11 == 10 {
+			buf.WriteByte('\n')
+		} else {
+			buf.WriteByte(' ')
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	plain := decompressTestInput()
+
+	var gz, zl bytes.Buffer
+	gzw := gzip.NewWriter(&gz)
+	_, _ = gzw.Write(plain)
+	require.NoError(t, gzw.Close())
+	zlw := zlib.NewWriter(&zl)
+	_, _ = zlw.Write(plain)
+	require.NoError(t, zlw.Close())
+
+	bz, err := hex.DecodeString("425a683931415926535981e013bb000003d9800010400010001664d0902000229930346a100001bd61c5c9dc7e1224fc5dc914e1424207804eec")
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name  string
+		in    []byte
+		plain []byte
+	}{
+		{"plain", plain, plain},
+		{"empty", nil, nil},
+		{"short", []byte("x"), []byte("x")},
+		{"gzip", gz.Bytes(), plain},
+		{"zlib", zl.Bytes(), plain},
+		{"bzip2", bz, []byte("hello bzip2\nworld\n")},
+		{"lzw", compressLZW(plain, 16, false), plain},
+		{"lzw 12 bits", compressLZW(plain, 12, false), plain},
+		{"lzw cleared", compressLZW(plain, 10, true), plain},
+		{"lzw fixture", lzwFixture, []byte("TOBEORNOTTOBEORTOBEORNOT#\n")},
+		{"zlib lookalike", []byte("hC is not zlib\n"), []byte("hC is not zlib\n")},
+		{"zlib header lookalike", []byte("x^2 + y^2\n"), []byte("x^2 + y^2\n")},
+		{"zlib header lookalike decoding", append([]byte("x^b"), plain...), append([]byte("x^b"), plain...)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rc, err := xre.Decompress(namedReader{bytes.NewReader(tc.in), tc.name})
+			require.NoError(t, err, "unexpected decompress error")
+			assert.Equal(t, tc.name, rc.(interface{ Name() string }).Name(), "expected name to be preserved")
+			out, err := ioutil.ReadAll(rc)
+			assert.NoError(t, err, "unexpected read error")
+			assert.Equal(t, len(tc.plain), len(out), "expected decompressed length")
+			assert.True(t, bytes.Equal(tc.plain, out), "expected decompressed content")
+			assert.NoError(t, rc.Close(), "unexpected close error")
+		})
+	}
+
+	t.Run("errors named", func(t *testing.T) {
+		rc, err := xre.Decompress(namedReader{bytes.NewReader(gz.Bytes()[:gz.Len()/2]), "half.gz"})
+		require.NoError(t, err, "unexpected decompress error")
+		_, err = ioutil.ReadAll(rc)
+		if assert.Error(t, err, "expected truncation error") {
+			assert.Equal(t, "half.gz: "+io.ErrUnexpectedEOF.Error(), err.Error())
+		}
+
+		_, err = xre.Decompress(namedReader{strings.NewReader("\x1f\x9d\x1f"), "wide.Z"})
+		assert.EqualError(t, err, "wide.Z: compress: unsupported max code width 31")
+	})
+}
+
+func TestSniffCompressed(t *testing.T) {
+	var gz bytes.Buffer
+	gzw := gzip.NewWriter(&gz)
+	_, _ = gzw.Write([]byte("hello\n"))
+	require.NoError(t, gzw.Close())
+	var zl bytes.Buffer
+	zlw := zlib.NewWriter(&zl)
+	_, _ = zlw.Write([]byte("hello\n"))
+	require.NoError(t, zlw.Close())
+
+	for _, tc := range []struct {
+		name    string
+		content []byte
+		want    bool
+	}{
+		{"gzip", gz.Bytes(), true},
+		{"bzip2", []byte("BZh91AY&SY"), true},
+		{"lzw", lzwFixture, true},
+		{"zlib", zl.Bytes(), false},
+		{"plain", []byte("hello\n"), false},
+		{"empty", nil, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := ioutil.TempFile("", "")
+			require.NoError(t, err, "unexpected tempfile error")
+			defer func() {
+				_ = f.Close()
+				_ = os.Remove(f.Name())
+			}()
+			_, err = f.Write(tc.content)
+			require.NoError(t, err, "unexpected write error")
+			assert.Equal(t, tc.want, xre.SniffCompressed(f), "expected sniffed")
+			off, err := f.Seek(0, io.SeekCurrent)
+			require.NoError(t, err, "unexpected seek error")
+			assert.Equal(t, int64(len(tc.content)), off, "expected offset to be unchanged")
+		})
+	}
+
+	t.Run("pipe", func(t *testing.T) {
+		pr, pw, err := os.Pipe()
+		require.NoError(t, err, "unexpected pipe error")
+		defer func() { _ = pr.Close() }()
+		_, err = pw.Write(gz.Bytes())
+		require.NoError(t, err, "unexpected write error")
+		require.NoError(t, pw.Close(), "unexpected close error")
+		assert.False(t, xre.SniffCompressed(pr), "expected pipe not to be sniffed")
+		out, err := ioutil.ReadAll(pr)
+		assert.NoError(t, err, "unexpected read error")
+		assert.Equal(t, gz.Bytes(), out, "expected pipe content to be unconsumed")
+	})
+}
+
+func TestFileEnv_Decompress(t *testing.T) {
+	plain := decompressTestInput()
+	lzw := compressLZW(plain, 16, true)
+
+	fe := xre.FileEnv{Decompress: true}
+	fe.AddReader(namedReader{bytes.NewReader(lzw), "in.Z"}, nil)
+	go func() {
+		defer fe.CloseInputs()
+		fe.AddReader(namedReader{bytes.NewReader(plain), "in.txt"}, nil)
+	}()
+
+	var n int
+	for in := range fe.Inputs() {
+		require.NoError(t, in.Err, "unexpected input error")
+		out, err := ioutil.ReadAll(in)
+		assert.NoError(t, err, "unexpected read error")
+		assert.True(t, bytes.Equal(plain, out), fmt.Sprintf("expected input %v to be decompressed", n))
+		n++
+	}
+	assert.Equal(t, 2, n, "expected inputs")
+}
@@ -3,9 +3,11 @@ package xre
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"time"
 )
 
 // Environment abstracts command runtime context; currently this only means
@@ -33,9 +35,60 @@ type FileEnv struct {
 	DefaultInfile  *os.File
 	DefaultOutfile *os.File
 
-	bufw *bufio.Writer
-	defp Processor
-	ins  chan Input
+	// Buffering controls when buffered output is flushed to DefaultOutfile;
+	// FlushInterval is only used under BufferInterval, where it defaults to
+	// DefaultFlushInterval.
+	Buffering     BufferMode
+	FlushInterval time.Duration
+
+	// Eager causes each token extracted by the outermost command to be
+	// processed as soon as it's complete, rather than once the next one is
+	// found, so that its output needn't wait on more input that may be slow to
+	// come, e.g. when following a growing file. However the last token of each
+	// input is then only known to be so after it's processed, so anything
+	// relying on it (e.g. a join) is only told so by a following empty token.
+	Eager bool
+
+	// OutputDelim, if non-nil, terminates every structure written by the
+	// default output processor, e.g. a NUL byte for output bound for
+	// `xargs -0`.
+	OutputDelim []byte
+
+	// Decompress causes every added input to be transparently decompressed,
+	// if its content is sniffed to be compressed (see the Decompress func).
+	Decompress bool
+
+	// Archives causes every added input named like a tar or zip archive (see
+	// IsArchiveName) to be expanded into an input for each of its regular
+	// members, rather than being added itself.
+	Archives bool
+
+	// Quiet discards all output; instead processing stops with ErrQuit once
+	// the first structure would have been written.
+	Quiet bool
+
+	// Count discards all output structures; instead their number is written
+	// as specified by the CountMode.
+	Count CountMode
+
+	// KeepGoing causes any error with an individual input (e.g. failing to
+	// open or read it) to be logged to ErrorLog as "name: error", rather than
+	// stopping processing; see InputErrors.
+	KeepGoing bool
+
+	// ErrorLog is where KeepGoing logs input errors; defaults to os.Stderr.
+	ErrorLog io.Writer
+
+	nerrs     int
+	stats     outputStats
+	counted   int
+	outw      io.Writer
+	bufw      *bufio.Writer
+	intw      *intervalWriter
+	defp      Processor
+	ins       chan Input
+	stop      chan struct{}
+	expanding chan struct{}
 }
 
 // Stdenv is the default expected Environment that defaults to reading from
@@ -71,54 +124,234 @@ func (fe *FileEnv) Inputs() <-chan Input {
 // running the command. This also means that it should at least call
 // AddInput(nil, nil) before running the command, if not open and add the first
 // input first.
+//
+// Once Close has been called, AddInput no longer blocks: any given file is
+// closed and dropped instead.
 func (fe *FileEnv) AddInput(f *os.File, err error) {
-	if fe.ins == nil {
-		fe.ins = make(chan Input, 1)
+	if f == nil {
+		fe.AddReader(nil, err)
+	} else {
+		fe.AddReader(f, err)
+	}
+}
+
+// AddReader is like AddInput, but for an arbitrary input stream, such as one
+// returned by FollowFile.
+//
+// Any archive expanded under Archives is expanded in a separate goroutine, so
+// that its members may be processed as they're added; any further AddReader or
+// CloseInputs call waits for it to be done.
+func (fe *FileEnv) AddReader(rc io.ReadCloser, err error) {
+	fe.init(1)
+	fe.awaitExpanding()
+	if fe.Decompress && rc != nil && err == nil {
+		rc, err = Decompress(rc)
 	}
 	if err != nil {
-		fe.ins <- Input{nil, err}
-	} else if f != nil {
-		fe.ins <- Input{f, nil}
+		fe.send(Input{nil, err})
+	} else if rc == nil {
+		return
+	} else if fe.Archives && IsArchiveName(inputName(Input{rc, nil})) {
+		done := make(chan struct{})
+		fe.expanding = done
+		go func() {
+			defer close(done)
+			expandArchive(rc, fe.stop, fe.send)
+		}()
+	} else {
+		fe.send(Input{rc, nil})
+	}
+}
+
+// send adds the given input, returning false if Close has been called, in
+// which case the input is closed and dropped instead.
+func (fe *FileEnv) send(in Input) bool {
+	select {
+	case fe.ins <- in:
+		return true
+	case <-fe.stop:
+		if in.ReadCloser != nil {
+			_ = in.ReadCloser.Close()
+		}
+		return false
+	}
+}
+
+func (fe *FileEnv) awaitExpanding() {
+	if fe.expanding != nil {
+		<-fe.expanding
+		fe.expanding = nil
 	}
 }
 
 // CloseInputs closes any input channel, allocating it if necessary first so
 // that any future AddInput or CloseInputs call will panic.
 func (fe *FileEnv) CloseInputs() {
+	fe.init(0)
+	fe.awaitExpanding()
+	close(fe.ins)
+}
+
+// Done returns a channel that is closed once Close has been called; any
+// goroutine adding inputs should stop once it is closed.
+func (fe *FileEnv) Done() <-chan struct{} {
+	fe.init(1)
+	return fe.stop
+}
+
+func (fe *FileEnv) init(inCap int) {
 	if fe.ins == nil {
-		fe.ins = make(chan Input, 0)
+		fe.ins = make(chan Input, inCap)
+		fe.stop = make(chan struct{})
 	}
-	close(fe.ins)
 }
 
 // Default returns the default output processor, which will write into the
-// provided DefaultOutfile through a buffered writer.
+// provided DefaultOutfile through a buffered writer, flushed as specified by
+// Buffering, terminating each structure with any OutputDelim. Every structure
+// written is counted (see Outputs), and only counted under Quiet or Count.
 func (fe *FileEnv) Default() Processor {
 	if fe.defp == nil {
-		fe.bufw = bufio.NewWriter(fe.DefaultOutfile) // TODO buffering control
-		fe.defp = writer{fe.bufw}
+		fe.bufw = bufio.NewWriter(fe.DefaultOutfile)
+		fe.outw = fe.bufw
+		switch fe.bufferMode() {
+		case BufferLine:
+			fe.outw = lineFlusher{fe.bufw}
+		case BufferInterval:
+			fe.intw = startIntervalWriter(fe.bufw, fe.FlushInterval)
+			fe.outw = fe.intw
+		}
+		fe.stats.quit = fe.Quiet
+		wr := writer{fe.outw, &fe.stats}
+		if fe.Quiet || fe.Count != CountNone {
+			wr.w = ioutil.Discard
+		}
+		if fe.OutputDelim != nil {
+			fe.defp = delimWriter{fe.OutputDelim, wr}
+		} else {
+			fe.defp = wr
+		}
 	}
 	return fe.defp
 }
 
-// Close flushes any open output buffer(s) and closes any open files.
+// Outputs returns how many structures have been written by the default
+// output processor so far.
+func (fe *FileEnv) Outputs() int { return fe.stats.n }
+
+func (fe *FileEnv) inputDone(name string) error {
+	if fe.Count != CountPerInput {
+		return nil
+	}
+	fe.Default()
+	n := fe.stats.n - fe.counted
+	fe.counted = fe.stats.n
+	_, err := fmt.Fprintf(fe.outw, "%s:%d\n", name, n)
+	if _, flush := fe.structureFlush(); err == nil && flush != nil {
+		err = flush()
+	}
+	return err
+}
+
+func (fe *FileEnv) bufferMode() BufferMode {
+	if fe.Buffering != BufferAuto {
+		return fe.Buffering
+	}
+	if info, err := fe.DefaultOutfile.Stat(); err == nil &&
+		info.Mode()&(os.ModeCharDevice|os.ModeNamedPipe) != 0 {
+		return BufferStructure
+	}
+	return BufferFull
+}
+
+func (fe *FileEnv) structureFlush() (eager bool, flush func() error) {
+	if fe.bufferMode() == BufferStructure {
+		flush = func() error {
+			if fe.bufw == nil {
+				return nil
+			}
+			return fe.bufw.Flush()
+		}
+	}
+	return fe.Eager, flush
+}
+
+// Close writes any total Count, flushes any open output buffer(s) and closes
+// any open files. Any inputs that were added but not yet processed are closed
+// and discarded, and any further added inputs will be dropped (see Done).
 func (fe *FileEnv) Close() error {
+	fe.stopInputs()
+	var err error
+	if fe.Count == CountTotal {
+		fe.Default()
+		_, err = fmt.Fprintf(fe.outw, "%d\n", fe.stats.n)
+	}
 	if fe.bufw == nil {
 		return nil
 	}
-	err := fe.bufw.Flush()
+	if fe.intw != nil {
+		if serr := fe.intw.stop(); err == nil {
+			err = serr
+		}
+	}
+	if ferr := fe.bufw.Flush(); err == nil {
+		err = ferr
+	}
 	if cerr := fe.DefaultOutfile.Close(); err == nil {
 		err = cerr
 	}
 	return err
 }
 
+func (fe *FileEnv) stopInputs() {
+	if fe.stop == nil {
+		return
+	}
+	select {
+	case <-fe.stop:
+		return
+	default:
+		close(fe.stop)
+	}
+	for {
+		select {
+		case in, ok := <-fe.ins:
+			if !ok {
+				return
+			}
+			if in.ReadCloser != nil {
+				_ = in.ReadCloser.Close()
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (fe *FileEnv) handleInputErrors() func(error) error {
+	if !fe.KeepGoing {
+		return nil
+	}
+	return func(err error) error {
+		w := fe.ErrorLog
+		if w == nil {
+			w = os.Stderr
+		}
+		fe.nerrs++
+		_, werr := fmt.Fprintf(w, "%v\n", err)
+		return werr
+	}
+}
+
+// InputErrors returns how many input errors have been logged under KeepGoing.
+func (fe *FileEnv) InputErrors() int { return fe.nerrs }
+
 // NullEnv is an Environment that discards all output, useful mainly for
 // examining processor structure separate from any real environment.
 var NullEnv Environment = _nullEnv{}
 
 func (ne _nullEnv) Inputs() <-chan Input { return nil }
-func (ne _nullEnv) Default() Processor   { return writer{ioutil.Discard} }
+func (ne _nullEnv) Default() Processor   { return writer{ioutil.Discard, nil} }
 func (ne _nullEnv) Close() error         { return nil }
 
 // BufEnv is an Environment that reads input from an in-memory buffer, and
@@ -186,7 +419,7 @@ func (be *BufEnv) SetInputs(rs ...io.Reader) {
 }
 
 // Default returns a processor that will write to the DefaultOutput buffer.
-func (be *BufEnv) Default() Processor { return writer{&be.DefaultOutput} }
+func (be *BufEnv) Default() Processor { return writer{&be.DefaultOutput, nil} }
 
 // Close does nothing.
 func (be *BufEnv) Close() error { return nil }
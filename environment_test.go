@@ -1,10 +1,15 @@
 package xre_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"io"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -43,6 +48,325 @@ func TestFileEnv_CloseInputs(t *testing.T) {
 	assert.False(t, ok, "expected receive to fail")
 }
 
+func TestFileEnv_Close(t *testing.T) {
+	f, err := ioutil.TempFile("", "")
+	require.NoError(t, err, "unexpected tempfile error")
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+
+	fe := xre.FileEnv{DefaultOutfile: f}
+	fe.AddInput(os.Open(os.DevNull))
+	added := make(chan struct{})
+	go func() {
+		defer close(added)
+		defer fe.CloseInputs()
+		for i := 0; i < 3; i++ {
+			fe.AddInput(os.Open(os.DevNull))
+		}
+	}()
+
+	assert.NoError(t, fe.Close(), "unexpected close error")
+	<-added
+	select {
+	case <-fe.Done():
+	default:
+		assert.Fail(t, "expected done channel to be closed")
+	}
+}
+
+func TestFileEnv_Buffering(t *testing.T) {
+	defer func(prior int) { xre.MinRead = prior }(xre.MinRead)
+	xre.MinRead = 1
+
+	for _, tc := range []struct {
+		name  string
+		mode  xre.BufferMode
+		eager bool
+		seen  string
+	}{
+		{"full", xre.BufferFull, false, ""},
+		{"structure", xre.BufferStructure, false, "aaa\n"},
+		{"structure eager", xre.BufferStructure, true, "aaa\nbbb\n"},
+		{"line", xre.BufferLine, false, "aaa\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := ioutil.TempFile("", "")
+			require.NoError(t, err, "unexpected tempfile error")
+			defer func() {
+				_ = f.Close()
+				_ = os.Remove(f.Name())
+			}()
+
+			fe := xre.FileEnv{
+				DefaultOutfile: f,
+				Buffering:      tc.mode,
+				Eager:          tc.eager,
+			}
+			cmd, err := xre.ParseCommand(`y"\n" p"\n"`)
+			require.NoError(t, err, "unexpected parse error")
+			rf, err := xre.BuildReaderFrom(cmd, &fe)
+			require.NoError(t, err, "unexpected build error")
+
+			var seen []byte
+			_, err = rf.ReadFrom(hookReader{
+				strings.NewReader("aaa\nbbb\nccc\n"),
+				func() { seen, _ = ioutil.ReadFile(f.Name()) },
+				len("aaa\nbbb\n"),
+			}.Reader())
+			assert.NoError(t, err, "unexpected read from error")
+			assert.Equal(t, tc.seen, string(seen), "expected output seen mid-stream")
+
+			assert.NoError(t, fe.Close(), "unexpected close error")
+			out, err := ioutil.ReadFile(f.Name())
+			assert.NoError(t, err, "unexpected read file error")
+			assert.Equal(t, "aaa\nbbb\nccc\n", string(out), "expected final output")
+		})
+	}
+}
+
+func TestFileEnv_BufferingSameOutput(t *testing.T) {
+	defer func(prior int) { xre.MinRead = prior }(xre.MinRead)
+	xre.MinRead = 1
+
+	const in = "a 1\nb 2\nc 3\n"
+	run := func(t *testing.T, prog string, mode xre.BufferMode, eager bool) string {
+		f, err := ioutil.TempFile("", "")
+		require.NoError(t, err, "unexpected tempfile error")
+		defer func() {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}()
+
+		fe := xre.FileEnv{
+			DefaultOutfile: f,
+			Buffering:      mode,
+			Eager:          eager,
+		}
+		cmd, err := xre.ParseCommand(prog)
+		require.NoError(t, err, "unexpected parse error")
+		rf, err := xre.BuildReaderFrom(cmd, &fe)
+		require.NoError(t, err, "unexpected build error")
+		_, err = rf.ReadFrom(iotest.OneByteReader(strings.NewReader(in)))
+		require.NoError(t, err, "unexpected read from error")
+		require.NoError(t, fe.Close(), "unexpected close error")
+		out, err := ioutil.ReadFile(f.Name())
+		require.NoError(t, err, "unexpected read file error")
+		return string(out)
+	}
+
+	for _, prog := range []string{
+		`y"\n" y" " j"-" p";"`,
+		`y"\n" x/\d/ j"+" p"\n"`,
+		`y"\n" j","`,
+		`y"\n" p"|"`,
+		`y"\n" g/[ac]/ j"," p"\n"`,
+		`y"\n" p%"[%s]" j","`,
+	} {
+		t.Run(prog, func(t *testing.T) {
+			want := run(t, prog, xre.BufferFull, false)
+			got := run(t, prog, xre.BufferStructure, false)
+			assert.Equal(t, want, got, "expected same output under structure buffering")
+			got = run(t, prog, xre.BufferStructure, true)
+			assert.Equal(t, want, got, "expected same output when eager")
+		})
+	}
+}
+
+func TestFileEnv_BufferingPipe(t *testing.T) {
+	for _, tc := range []struct {
+		prog string
+		in   string
+		out  string
+	}{
+		{`y"\n" g/a/ j"," p"\n"`, "a1\nb\na2\n", "a1,a2\n"},
+		{`y"\n" p%"[%s]" j","`, "a\nb\nc\n", "[a],[b],[c]"},
+	} {
+		t.Run(tc.prog, func(t *testing.T) {
+			r, w, err := os.Pipe()
+			require.NoError(t, err, "unexpected pipe error")
+			defer func() { _ = r.Close() }()
+			var out []byte
+			read := make(chan struct{})
+			go func() {
+				defer close(read)
+				out, _ = ioutil.ReadAll(r)
+			}()
+
+			fe := xre.FileEnv{DefaultOutfile: w}
+			fe.AddReader(ioutil.NopCloser(strings.NewReader(tc.in)), nil)
+			fe.CloseInputs()
+			assert.NoError(t, xre.RunCommand(tc.prog, &fe), "unexpected run error")
+			<-read
+			assert.Equal(t, tc.out, string(out), "expected output through a pipe")
+		})
+	}
+}
+
+// hookReader calls a hook function once after the given number of bytes have
+// been read.
+type hookReader struct {
+	r     io.Reader
+	hook  func()
+	after int
+}
+
+func (hr hookReader) Reader() io.Reader { return &hr }
+
+func (hr *hookReader) Read(p []byte) (int, error) {
+	if hr.after == 0 && hr.hook != nil {
+		hr.hook()
+		hr.hook = nil
+	}
+	if hr.after > 0 && len(p) > hr.after {
+		p = p[:hr.after]
+	}
+	n, err := hr.r.Read(p)
+	hr.after -= n
+	return n, err
+}
+
+func TestFileEnv_OutputDelim(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		run  func(prog string, env *xre.FileEnv) error
+	}{
+		{"sequential", func(prog string, env *xre.FileEnv) error {
+			return xre.RunCommand(prog, env)
+		}},
+		{"parallel", func(prog string, env *xre.FileEnv) error {
+			return xre.RunCommandParallel(context.Background(), prog, env, xre.ParallelOptions{Workers: 2})
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := ioutil.TempFile("", "")
+			require.NoError(t, err, "unexpected tempfile error")
+			defer func() {
+				_ = f.Close()
+				_ = os.Remove(f.Name())
+			}()
+
+			fe := xre.FileEnv{
+				DefaultOutfile: f,
+				OutputDelim:    []byte{0},
+			}
+			fe.AddReader(namedReader{strings.NewReader("a b\nc\n"), "in1"}, nil)
+			go func() {
+				defer fe.CloseInputs()
+				fe.AddReader(namedReader{strings.NewReader("d\ne f"), "in2"}, nil)
+			}()
+			assert.NoError(t, tc.run(`y"\n" x/\w+/ j","`, &fe), "unexpected run error")
+
+			out, err := ioutil.ReadFile(f.Name())
+			assert.NoError(t, err, "unexpected read file error")
+			assert.Equal(t, "a,b\x00c\x00d\x00e,f\x00", string(out), "expected NUL terminated output")
+		})
+	}
+}
+
+type failReader struct{ err error }
+
+func (fr failReader) Read(p []byte) (int, error) { return 0, fr.err }
+
+func TestFileEnv_KeepGoing(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		run  func(prog string, env *xre.FileEnv) error
+	}{
+		{"sequential", func(prog string, env *xre.FileEnv) error {
+			return xre.RunCommand(prog, env)
+		}},
+		{"parallel", func(prog string, env *xre.FileEnv) error {
+			return xre.RunCommandParallel(context.Background(), prog, env, xre.ParallelOptions{Workers: 2})
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := ioutil.TempFile("", "")
+			require.NoError(t, err, "unexpected tempfile error")
+			defer func() {
+				_ = f.Close()
+				_ = os.Remove(f.Name())
+			}()
+
+			var errLog bytes.Buffer
+			fe := xre.FileEnv{
+				DefaultOutfile: f,
+				KeepGoing:      true,
+				ErrorLog:       &errLog,
+			}
+			fe.AddReader(namedReader{strings.NewReader("a\n"), "in1"}, nil)
+			go func() {
+				defer fe.CloseInputs()
+				fe.AddReader(nil, errors.New("in2: can't open"))
+				fe.AddReader(namedReader{failReader{errors.New("bad read")}, "in3"}, nil)
+				fe.AddReader(namedReader{strings.NewReader("b\n"), "in4"}, nil)
+			}()
+			assert.NoError(t, tc.run(`y"\n" p";"`, &fe), "unexpected run error")
+			assert.Equal(t, 2, fe.InputErrors(), "expected input errors")
+			assert.Equal(t, "in2: can't open\nin3: bad read\n", errLog.String(), "expected logged errors")
+
+			out, err := ioutil.ReadFile(f.Name())
+			assert.NoError(t, err, "unexpected read file error")
+			assert.Equal(t, "a;b;", string(out), "expected output from good inputs")
+		})
+	}
+}
+
+func TestFileEnv_Count(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		count    xre.CountMode
+		quiet    bool
+		parallel bool
+		err      error
+		out      string
+		outputs  int
+	}{
+		{name: "none", out: "a;b;c;d,e;f;", outputs: 5},
+		{name: "total", count: xre.CountTotal, out: "5\n", outputs: 5},
+		{name: "per input", count: xre.CountPerInput, out: "in1:2\nin2:0\nin3:3\n", outputs: 5},
+		{name: "parallel total", count: xre.CountTotal, parallel: true, out: "5\n", outputs: 5},
+		{name: "parallel per input", count: xre.CountPerInput, parallel: true, out: "in1:2\nin2:0\nin3:3\n", outputs: 5},
+		{name: "quiet", quiet: true, err: xre.ErrQuit, outputs: 1},
+		{name: "parallel quiet", quiet: true, parallel: true, err: xre.ErrQuit, outputs: 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := ioutil.TempFile("", "")
+			require.NoError(t, err, "unexpected tempfile error")
+			defer func() {
+				_ = f.Close()
+				_ = os.Remove(f.Name())
+			}()
+
+			fe := xre.FileEnv{
+				DefaultOutfile: f,
+				Count:          tc.count,
+				Quiet:          tc.quiet,
+			}
+			fe.AddReader(namedReader{strings.NewReader("a\nb\n"), "in1"}, nil)
+			go func() {
+				defer fe.CloseInputs()
+				fe.AddReader(namedReader{strings.NewReader("\n\n"), "in2"}, nil)
+				fe.AddReader(namedReader{strings.NewReader("c\nd e\nf"), "in3"}, nil)
+			}()
+
+			prog := `y"\n" g/./ x/\w+/ j"," p";"`
+			if tc.parallel {
+				err = xre.RunCommandParallel(context.Background(), prog, &fe, xre.ParallelOptions{Workers: 2})
+			} else {
+				err = xre.RunCommand(prog, &fe)
+			}
+			assert.Equal(t, tc.err, err, "expected run error")
+			assert.Equal(t, tc.outputs, fe.Outputs(), "expected output count")
+
+			out, err := ioutil.ReadFile(f.Name())
+			assert.NoError(t, err, "unexpected read file error")
+			assert.Equal(t, tc.out, string(out), "expected output")
+		})
+	}
+}
+
 func TestBufEnv_Input(t *testing.T) {
 	var be xre.BufEnv
 	defer func() {
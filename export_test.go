@@ -0,0 +1,7 @@
+package xre
+
+// Internals exported for the external xre_test package.
+var (
+	ShardDelim  = shardDelim
+	ShardBounds = shardBounds
+)
@@ -12,8 +12,45 @@ func scanX(s string) (Command, string, error) {
 	switch c := s[0]; c {
 
 	case '[', '{', '(', '<':
-		s = s[1:]
-		return ProtoCommand{extractBalanced{c, balancedOpens[c]}}, s, nil
+		if c == '<' {
+			if name, rest, ok := scanElementSpec(s[1:]); ok {
+				return ProtoCommand{extractElement{name}}, rest, nil
+			}
+		}
+		if c == '(' && len(s) > 1 && (s[1] == '"' || s[1] == '/') {
+			bd, s, err := scanDelimitedSpec(s[1:])
+			if err != nil {
+				return nil, s, err
+			}
+			return ProtoCommand{extractDelimited(bd)}, s, nil
+		}
+		bb, s, err := scanBalancedSpec(c, s[1:])
+		if err != nil {
+			return nil, s, err
+		}
+		return ProtoCommand{extractBalanced(bb)}, s, nil
+
+	case '@':
+		return scanXAt(s[1:])
+
+	case '>':
+		xi, s, err := scanIndentSpec(s[1:])
+		if err != nil {
+			return nil, s, err
+		}
+		return ProtoCommand{xi}, s, nil
+
+	case 'k':
+		return scanXK(s[1:])
+
+	case '#':
+		return scanXHash(s[1:])
+
+	case 'c':
+		return scanXC(s[1:])
+
+	case 'j':
+		return scanXJ(s[1:])
 
 	case '/':
 		pat, s, err := scanPat(c, s[1:])
@@ -87,7 +124,8 @@ func (erss extractReSubs) Create(next Processor) Processor {
 	return &matchProcessor{matcher: erss, next: next}
 }
 
-func (eb extractBalanced) String() string { return fmt.Sprintf("x%s", string(eb.open)) }
-func (er extractRe) String() string       { return fmt.Sprintf("x%v", regexpString(er.pat)) }
-func (ers extractReSub) String() string   { return fmt.Sprintf("x%v", regexpString(ers.pat)) }
-func (erss extractReSubs) String() string { return fmt.Sprintf("x%v", regexpString(erss.pat)) }
+func (eb extractBalanced) String() string  { return "x" + betweenBalanced(eb).spec() }
+func (ed extractDelimited) String() string { return "x" + betweenDelimited(ed).spec() }
+func (er extractRe) String() string        { return fmt.Sprintf("x%v", regexpString(er.pat)) }
+func (ers extractReSub) String() string    { return fmt.Sprintf("x%v", regexpString(ers.pat)) }
+func (erss extractReSubs) String() string  { return fmt.Sprintf("x%v", regexpString(erss.pat)) }
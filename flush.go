@@ -0,0 +1,188 @@
+package xre
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// BufferMode controls when a FileEnv flushes its buffered output.
+type BufferMode int
+
+const (
+	// BufferAuto uses BufferStructure when writing to a terminal or pipe,
+	// and BufferFull otherwise.
+	BufferAuto BufferMode = iota
+
+	// BufferFull only flushes when the output buffer is full, and when the
+	// environment is closed.
+	BufferFull
+
+	// BufferStructure flushes the output of every top-level structure, i.e.
+	// every piece of output caused by a token of the outermost command, before
+	// waiting on any more input.
+	BufferStructure
+
+	// BufferLine flushes after every write that contains a newline.
+	BufferLine
+
+	// BufferInterval flushes periodically, see FileEnv.FlushInterval.
+	BufferInterval
+)
+
+// DefaultFlushInterval is the flush period used by BufferInterval when no
+// FileEnv.FlushInterval is given.
+var DefaultFlushInterval = time.Second
+
+var bufferModeNames = [...]string{
+	BufferAuto:      "auto",
+	BufferFull:      "full",
+	BufferStructure: "structure",
+	BufferLine:      "line",
+	BufferInterval:  "interval",
+}
+
+func (bm BufferMode) String() string {
+	if int(bm) < len(bufferModeNames) {
+		return bufferModeNames[bm]
+	}
+	return fmt.Sprintf("BufferMode(%d)", int(bm))
+}
+
+// ParseBufferMode parses a BufferMode from its name, as returned by String.
+func ParseBufferMode(s string) (BufferMode, error) {
+	for bm, name := range bufferModeNames {
+		if name == s {
+			return BufferMode(bm), nil
+		}
+	}
+	return BufferAuto, fmt.Errorf("invalid buffer mode %q", s)
+}
+
+// structureFlusher may be implemented by an Environment whose output may be
+// consumed live; any returned flush function is called whenever processing
+// would wait on more input, and if eager, top-level structures are processed
+// as soon as they're complete (see FileEnv.Eager).
+type structureFlusher interface {
+	structureFlush() (eager bool, flush func() error)
+}
+
+// flushReaderFrom calls flush whenever processing would wait on more input,
+// i.e. before every read but the first, and once done; so that the output of
+// every top-level structure processed so far is seen without waiting on input,
+// while still only flushing once per read, rather than once per structure.
+type flushReaderFrom struct {
+	rf    io.ReaderFrom
+	flush func() error
+}
+
+type flushReader struct {
+	r     io.Reader
+	flush func() error
+	read  bool
+}
+
+func (fr flushReaderFrom) ReadFrom(r io.Reader) (int64, error) {
+	n, err := fr.rf.ReadFrom(&flushReader{r: r, flush: fr.flush})
+	if ferr := fr.flush(); err == nil {
+		err = ferr
+	}
+	return n, err
+}
+
+func (fr *flushReader) Read(p []byte) (int, error) {
+	if fr.read {
+		if err := fr.flush(); err != nil {
+			return 0, err
+		}
+	}
+	fr.read = true
+	return fr.r.Read(p)
+}
+
+// flushProc calls flush after processing each buffer, e.g. a whole memory
+// mapped input in place of a flushReaderFrom.
+type flushProc struct {
+	Processor
+	flush func() error
+}
+
+func (fp flushProc) Process(buf []byte, last bool) error {
+	err := fp.Processor.Process(buf, last)
+	if err == nil {
+		err = fp.flush()
+	}
+	return err
+}
+
+func (fr flushReaderFrom) String() string { return fmt.Sprint(fr.rf) }
+func (fp flushProc) String() string       { return fmt.Sprint(fp.Processor) }
+
+type lineFlusher struct{ *bufio.Writer }
+
+func (lf lineFlusher) Write(p []byte) (int, error) {
+	n, err := lf.Writer.Write(p)
+	if err == nil && bytes.IndexByte(p, '\n') >= 0 {
+		err = lf.Writer.Flush()
+	}
+	return n, err
+}
+
+// intervalWriter serializes writes with a background goroutine that flushes
+// periodically; any flush error is returned by the next write, or by stop.
+type intervalWriter struct {
+	mu   sync.Mutex
+	bufw *bufio.Writer
+	err  error
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func startIntervalWriter(bufw *bufio.Writer, interval time.Duration) *intervalWriter {
+	if interval <= 0 {
+		interval = DefaultFlushInterval
+	}
+	iw := &intervalWriter{
+		bufw: bufw,
+		done: make(chan struct{}),
+	}
+	iw.wg.Add(1)
+	go iw.run(interval)
+	return iw
+}
+
+func (iw *intervalWriter) run(interval time.Duration) {
+	defer iw.wg.Done()
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-iw.done:
+			return
+		case <-tick.C:
+			iw.mu.Lock()
+			if err := iw.bufw.Flush(); iw.err == nil {
+				iw.err = err
+			}
+			iw.mu.Unlock()
+		}
+	}
+}
+
+func (iw *intervalWriter) Write(p []byte) (int, error) {
+	iw.mu.Lock()
+	defer iw.mu.Unlock()
+	if iw.err != nil {
+		return 0, iw.err
+	}
+	return iw.bufw.Write(p)
+}
+
+func (iw *intervalWriter) stop() error {
+	close(iw.done)
+	iw.wg.Wait()
+	return iw.err
+}
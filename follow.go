@@ -0,0 +1,106 @@
+package xre
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+)
+
+// DefaultFollowPoll is how often FollowFile checks for new data when no
+// explicit poll interval is given.
+var DefaultFollowPoll = 250 * time.Millisecond
+
+// FollowFile opens the named file for reading like `tail -F`: rather than
+// returning io.EOF at the end of the file, reads wait for more data to be
+// appended. If the file is replaced (e.g. by log rotation) reading continues
+// from the start of the new file, and if it's truncated reading starts over.
+//
+// The returned reader only reports io.EOF once the given context is done, so
+// that any partial trailing structure is only flushed as final then.
+func FollowFile(ctx context.Context, name string, poll time.Duration) (io.ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if poll <= 0 {
+		poll = DefaultFollowPoll
+	}
+	return &follower{ctx: ctx, name: name, poll: poll, f: f}, nil
+}
+
+type follower struct {
+	ctx  context.Context
+	name string
+	poll time.Duration
+	f    *os.File
+	off  int64
+}
+
+// Name returns the name of the file being followed.
+func (fl *follower) Name() string { return fl.name }
+
+func (fl *follower) Read(p []byte) (int, error) {
+	for {
+		n, err := fl.f.Read(p)
+		fl.off += int64(n)
+		if n > 0 {
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if reopened, err := fl.check(); err != nil {
+			return 0, err
+		} else if reopened {
+			continue
+		}
+		select {
+		case <-fl.ctx.Done():
+			return 0, io.EOF
+		case <-time.After(fl.poll):
+		}
+	}
+}
+
+// check handles the followed file having been replaced or truncated, returning
+// true if reading should be retried immediately.
+func (fl *follower) check() (bool, error) {
+	info, err := os.Stat(fl.name)
+	if os.IsNotExist(err) {
+		// moved away, but not yet replaced; keep reading the old file for
+		// now, since its writer may not have moved on yet either
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	cur, err := fl.f.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	if !os.SameFile(info, cur) {
+		f, err := os.Open(fl.name)
+		if os.IsNotExist(err) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		_ = fl.f.Close()
+		fl.f, fl.off = f, 0
+		return true, nil
+	}
+
+	if cur.Size() < fl.off {
+		if _, err := fl.f.Seek(0, io.SeekStart); err != nil {
+			return false, err
+		}
+		fl.off = 0
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func (fl *follower) Close() error { return fl.f.Close() }
@@ -0,0 +1,85 @@
+package xre_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jcorbin/xre"
+)
+
+func TestFollowFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xre-follow")
+	require.NoError(t, err, "unexpected tempdir error")
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	name := filepath.Join(dir, "app.log")
+	write := func(flag int, s string) {
+		f, err := os.OpenFile(name, flag|os.O_WRONLY|os.O_CREATE, 0644)
+		require.NoError(t, err, "unexpected open error")
+		_, err = f.WriteString(s)
+		require.NoError(t, err, "unexpected write error")
+		require.NoError(t, f.Close(), "unexpected close error")
+	}
+	write(os.O_TRUNC, "one\ntw")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rc, err := xre.FollowFile(ctx, name, time.Millisecond)
+	require.NoError(t, err, "unexpected follow error")
+	defer func() { assert.NoError(t, rc.Close(), "unexpected close error") }()
+
+	chunks := make(chan string)
+	done := make(chan error, 1)
+	go func() {
+		var buf [64]byte
+		for {
+			n, err := rc.Read(buf[:])
+			if n > 0 {
+				chunks <- string(buf[:n])
+			}
+			if err != nil {
+				done <- err
+				return
+			}
+		}
+	}()
+
+	var got string
+	expect := func(want string) {
+		timeout := time.After(5 * time.Second)
+		for got != want {
+			select {
+			case chunk := <-chunks:
+				got += chunk
+			case err := <-done:
+				require.Fail(t, "unexpected read end", "error: %v, got %q, want %q", err, got, want)
+			case <-timeout:
+				require.Fail(t, "timed out", "got %q, want %q", got, want)
+			}
+		}
+	}
+
+	expect("one\ntw")
+
+	write(os.O_APPEND, "o\n")
+	expect("one\ntwo\n")
+
+	require.NoError(t, os.Rename(name, name+".1"), "unexpected rename error")
+	write(os.O_TRUNC, "three\n")
+	expect("one\ntwo\nthree\n")
+
+	write(os.O_TRUNC, "")
+	write(os.O_APPEND, "four\n")
+	expect("one\ntwo\nthree\nfour\n")
+
+	cancel()
+	assert.Equal(t, io.EOF, <-done, "expected EOF once cancelled")
+}
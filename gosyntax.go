@@ -0,0 +1,116 @@
+package xre
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"sort"
+	"strings"
+)
+
+// scanXAt parses a syntax-aware extraction command, like x@go:func, after its
+// "x@": a language name, and the kind of structure to extract.
+func scanXAt(s string) (Command, string, error) {
+	i := strings.IndexByte(s, ':')
+	if i < 0 {
+		return nil, s, fmt.Errorf("expected language: after x@")
+	}
+	lang, s := s[:i], s[i+1:]
+	j := 0
+	for j < len(s) && ('a' <= s[j] && s[j] <= 'z' || '0' <= s[j] && s[j] <= '9') {
+		j++
+	}
+	kind, s := s[:j], s[j:]
+	switch lang {
+	case "go":
+		xg := extractGo(kind)
+		if _, ok := goExtractors[xg]; !ok {
+			return nil, s, fmt.Errorf("unrecognized x@go kind %q", kind)
+		}
+		return ProtoCommand{xg}, s, nil
+	case "md":
+		return scanMarkdownSpec(kind, s)
+	default:
+		return nil, s, fmt.Errorf("unrecognized x@ language %q", lang)
+	}
+}
+
+// extractGo extracts the exact source bytes of a kind of Go syntax node from
+// each whole Go source file: "func" for each function or method declaration,
+// "type" for each type declaration (possibly of a parenthesized group),
+// "import" for each import spec, and "comment" for each comment group.
+type extractGo string
+
+var goExtractors = map[extractGo]func(f *ast.File, each func(ast.Node)){
+	"func": func(f *ast.File, each func(ast.Node)) {
+		for _, decl := range f.Decls {
+			if fd, ok := decl.(*ast.FuncDecl); ok {
+				each(fd)
+			}
+		}
+	},
+	"type": func(f *ast.File, each func(ast.Node)) {
+		for _, decl := range f.Decls {
+			if gd, ok := decl.(*ast.GenDecl); ok && gd.Tok == token.TYPE {
+				each(gd)
+			}
+		}
+	},
+	"import": func(f *ast.File, each func(ast.Node)) {
+		for _, spec := range f.Imports {
+			each(spec)
+		}
+	},
+	"comment": func(f *ast.File, each func(ast.Node)) {
+		for _, cg := range f.Comments {
+			each(cg)
+		}
+	},
+}
+
+func (xg extractGo) String() string { return "x@go:" + string(xg) }
+
+func (xg extractGo) Create(next Processor) Processor {
+	return &matchProcessor{next: next, matcher: xg}
+}
+
+// match waits for the whole source file, since it can only be parsed as a
+// whole, and then processes each selected node directly.
+func (xg extractGo) match(mp *matchProcessor, buf []byte) error {
+	if mp.buf.Err() != io.EOF {
+		return nil
+	}
+
+	fset := token.NewFileSet()
+	var mode parser.Mode
+	switch xg {
+	case "comment":
+		mode = parser.ParseComments
+	case "import":
+		mode = parser.ImportsOnly
+	}
+	f, err := parser.ParseFile(fset, "", buf, mode)
+	if err != nil {
+		return fmt.Errorf("go: %v", err)
+	}
+	tf := fset.File(f.Package)
+
+	var locs [][2]int
+	goExtractors[xg](f, func(node ast.Node) {
+		locs = append(locs, [2]int{tf.Offset(node.Pos()), tf.Offset(node.End())})
+	})
+	sort.Slice(locs, func(i, j int) bool { return locs[i][0] < locs[j][0] })
+
+	if err := mp.procPrior(false); err != nil {
+		return err
+	}
+	for _, loc := range locs {
+		if err := mp.yield(buf[loc[0]:loc[1]], false); err != nil {
+			return err
+		}
+	}
+	mp.buf.Advance(len(buf))
+	return nil
+}
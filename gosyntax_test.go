@@ -0,0 +1,64 @@
+package xre_test
+
+import "testing"
+
+var goSource = []byte(`// Package demo is a demo.
+package demo
+
+import (
+	"fmt"
+	str "strings" // for Title
+)
+
+import "os"
+
+type (
+	a int
+	b struct{ s string }
+)
+
+// T is a "type" with a method.
+type T struct{}
+
+func (T) String() string { return "func main() {}" }
+
+func main() {
+	type local int
+	fmt.Println(str.Title("hi"), os.Args)
+}
+`)
+
+func Test_extractGo(t *testing.T) {
+	cmdTestCases{
+		{name: "funcs",
+			cmd: `x@go:func y"\n" g/^func/ p"\n"`,
+			in:  goSource,
+			out: []byte(`func (T) String() string { return "func main() {}" }
+func main() {
+`),
+		},
+		{name: "types",
+			cmd: `x@go:type p%"%q\n"`,
+			in:  goSource,
+			out: []byte(`"type (\n\ta int\n\tb struct{ s string }\n)"
+"type T struct{}"
+`),
+		},
+		{name: "imports",
+			cmd: `x@go:import p"\n"`,
+			in:  goSource,
+			out: []byte(`"fmt"
+str "strings"
+"os"
+`),
+		},
+		{name: "comments",
+			cmd: `x@go:comment p"\n"`,
+			in:  goSource,
+			out: []byte(`// Package demo is a demo.
+// for Title
+// T is a "type" with a method.
+`),
+		},
+	}.run(t)
+}
@@ -0,0 +1,166 @@
+package xre
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// defaultTabWidth is the number of columns between tab stops used to measure
+// indentation, unless another is given.
+const defaultTabWidth = 8
+
+// extractIndent extracts each indentation block: a (non-blank) line, and all
+// following lines indented deeper than it; betweenIndent extracts only the
+// deeper lines of each block. Blank lines are included within a block, unless
+// blankEnds is set, but never at its end.
+type extractIndent struct {
+	tabWidth  int
+	blankEnds bool
+}
+type betweenIndent extractIndent
+
+// scanIndentSpec parses the options of an indentation block command after its
+// ">": a tab width like t4, and b to end blocks at blank lines.
+func scanIndentSpec(s string) (extractIndent, string, error) {
+	xi := extractIndent{tabWidth: defaultTabWidth}
+	for len(s) > 0 {
+		switch s[0] {
+		case 't':
+			n, rest, err := scanInt(s[1:])
+			if err != nil {
+				return xi, rest, err
+			}
+			if rest == s[1:] || n < 1 {
+				return xi, rest, errors.New("expected tab width after t")
+			}
+			xi.tabWidth, s = n, rest
+		case 'b':
+			xi.blankEnds, s = true, s[1:]
+		default:
+			return xi, s, nil
+		}
+	}
+	return xi, s, nil
+}
+
+func (xi extractIndent) spec() string {
+	spec := ">"
+	if xi.tabWidth != defaultTabWidth {
+		spec += "t" + strconv.Itoa(xi.tabWidth)
+	}
+	if xi.blankEnds {
+		spec += "b"
+	}
+	return spec
+}
+
+func (xi extractIndent) String() string { return "x" + xi.spec() }
+func (yi betweenIndent) String() string { return "y" + extractIndent(yi).spec() }
+
+func (xi extractIndent) Create(next Processor) Processor {
+	return &matchProcessor{next: next, matcher: xi}
+}
+func (yi betweenIndent) Create(next Processor) Processor {
+	return &matchProcessor{next: next, matcher: yi}
+}
+
+func (xi extractIndent) match(mp *matchProcessor, buf []byte) error {
+	if loc, found := xi.scan(buf, mp.buf.Err() == io.EOF); found {
+		return mp.pushLoc(loc[0], loc[2], loc[2])
+	}
+	return nil
+}
+
+func (yi betweenIndent) match(mp *matchProcessor, buf []byte) error {
+	loc, found := extractIndent(yi).scan(buf, mp.buf.Err() == io.EOF)
+	if !found {
+		return nil
+	}
+	if loc[1] == loc[2] {
+		// no deeper lines
+		if err := mp.procPrior(false); err != nil {
+			return err
+		}
+		mp.buf.Advance(loc[2])
+		return nil
+	}
+	return mp.pushLoc(loc[1], loc[2], loc[2])
+}
+
+// scan finds the first indentation block in buf, skipping any leading blank
+// lines, returning the start of its first line, the start of its deeper lines,
+// and its end. A block is only found once the line after it has been, unless
+// atEOF.
+func (xi extractIndent) scan(buf []byte, atEOF bool) (loc [3]int, found bool) {
+	off := 0
+	for {
+		line, next, complete := nextLine(buf, off)
+		if !complete && !atEOF || off == len(buf) {
+			return loc, false
+		}
+		if _, blank := xi.indent(line); !blank {
+			break
+		}
+		off = next
+	}
+
+	line, next, complete := nextLine(buf, off)
+	if !complete && !atEOF {
+		return loc, false
+	}
+	indent, _ := xi.indent(line)
+	loc[0] = off
+	loc[1], loc[2] = next, next
+
+	for off = next; off < len(buf); {
+		line, next, complete := nextLine(buf, off)
+		ind, blank := xi.indent(line)
+		if blank {
+			if !complete && !atEOF {
+				return loc, false
+			}
+			if xi.blankEnds {
+				return loc, true
+			}
+			off = next
+			continue
+		}
+		if ind <= indent {
+			return loc, true
+		}
+		if !complete && !atEOF {
+			return loc, false
+		}
+		off = next
+		loc[2] = off
+	}
+	return loc, atEOF
+}
+
+// indent measures the indentation of a line in columns, returning blank=true
+// if it's all whitespace.
+func (xi extractIndent) indent(line []byte) (col int, blank bool) {
+	for _, c := range line {
+		switch c {
+		case ' ':
+			col++
+		case '\t':
+			col += xi.tabWidth - col%xi.tabWidth
+		case '\r':
+		default:
+			return col, false
+		}
+	}
+	return col, true
+}
+
+// nextLine returns the line starting at off within buf, the offset after it,
+// and whether it was newline terminated.
+func nextLine(buf []byte, off int) (line []byte, next int, complete bool) {
+	if i := bytes.IndexByte(buf[off:], '\n'); i >= 0 {
+		return buf[off : off+i], off + i + 1, true
+	}
+	return buf[off:], len(buf), false
+}
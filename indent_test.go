@@ -0,0 +1,56 @@
+package xre_test
+
+import "testing"
+
+var indentDoc = []byte("a:\n  b: 1\n\n  c:\n    d: 2\n\ne: 3\n\tf: 4\n        g: 5\nh")
+
+func Test_indent(t *testing.T) {
+	cmdTestCases{
+		{name: "extract blocks",
+			cmd: `x> p%"%q\n"`,
+			in:  indentDoc,
+			out: []byte(`"a:\n  b: 1\n\n  c:\n    d: 2\n"
+"e: 3\n\tf: 4\n        g: 5\n"
+"h"
+`),
+		},
+		{name: "between blocks",
+			cmd: `y> p%"%q\n"`,
+			in:  indentDoc,
+			out: []byte(`"  b: 1\n\n  c:\n    d: 2\n"
+"\tf: 4\n        g: 5\n"
+`),
+		},
+		{name: "nested blocks",
+			cmd: `y> x> p%"%q\n"`,
+			in:  indentDoc,
+			out: []byte(`"  b: 1\n"
+"  c:\n    d: 2\n"
+"\tf: 4\n"
+"        g: 5\n"
+`),
+		},
+		{name: "tab width",
+			cmd: `y> x>t4 p%"%q\n"`,
+			in:  indentDoc,
+			out: []byte(`"  b: 1\n"
+"  c:\n    d: 2\n"
+"\tf: 4\n        g: 5\n"
+`),
+		},
+		{name: "blank lines end blocks",
+			cmd: `x>b p%"%q\n"`,
+			in:  indentDoc,
+			out: []byte(`"a:\n  b: 1\n"
+"  c:\n    d: 2\n"
+"e: 3\n\tf: 4\n        g: 5\n"
+"h"
+`),
+		},
+		{name: "python defs",
+			cmd: `x> g/^def/ y"\n" g/return/ p"\n"`,
+			in:  []byte("import os\n\ndef f(x):\n    if x:\n        return 1\n\n    return 2\n\nclass C:\n    def g(self):\n        return 3\n"),
+			out: []byte("        return 1\n    return 2\n"),
+		},
+	}.run(t)
+}
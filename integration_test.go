@@ -21,7 +21,7 @@ import (
 
 func Test_integration(t *testing.T) {
 	testCases := intTestCases{
-		{name: "no command"},
+		{name: "no command", status: 1},
 
 		{name: "parse error",
 			xreCmd: "bogus",
@@ -46,6 +46,7 @@ func Test_integration(t *testing.T) {
 		},
 
 		{name: "searching from git log (no match)",
+			status: 1,
 			sysCmd: []string{"git", "log", "--decorate", "--abbrev-commit", "HEAD~40.."},
 			xreCmd: `y/^commit\s+/ g/John Jacob Jingleheimer-Schmidt/ p%"%q\n"`,
 			check: func(t *testing.T, outb []byte) {
@@ -57,45 +58,14 @@ func Test_integration(t *testing.T) {
 			sysCmd: []string{"find", ".", "-name", "*.go"},
 			xreCmd: `x/import \((.+?)\)/s y/\n/ x/"(.+?)"/ p"\n"`,
 			listIn: true,
-			check: func(t *testing.T, outb []byte) {
-				counts := countSep(outb, []byte("\n"))
-				for _, k := range []string{
-					"bufio",
-					"bytes",
-					"errors",
-					"flag",
-					"fmt",
-					"github.com/jcorbin/xre",
-					"github.com/jcorbin/xre/internal/cmdutil",
-					"github.com/stretchr/testify/assert",
-					"github.com/stretchr/testify/require",
-					"io",
-					"io/ioutil",
-					"log",
-					"os",
-					"os/exec",
-					"path/filepath",
-					"regexp",
-					"runtime/pprof",
-					"runtime/trace",
-					"sort",
-					"strconv",
-					"strings",
-					"sync",
-					"testing",
-					"unicode",
-				} {
-					_, def := counts[k]
-					assert.True(t, def, "expected output key %q", k)
-					delete(counts, k)
-				}
-				var extra []string
-				for k := range counts {
-					extra = append(extra, k)
-				}
-				sort.Strings(extra)
-				assert.Equal(t, []string(nil), extra, "unexpected extra output keys")
-			},
+			check:  checkAllImports,
+		},
+
+		{name: "all imports (go syntax)",
+			sysCmd: []string{"find", ".", "-name", "*.go"},
+			xreCmd: `x@go:import x/"(.+?)"/ p"\n"`,
+			listIn: true,
+			check:  checkAllImports,
 		},
 	}
 
@@ -109,6 +79,66 @@ func Test_integration(t *testing.T) {
 	}
 }
 
+func checkAllImports(t *testing.T, outb []byte) {
+	counts := countSep(outb, []byte("\n"))
+	for _, k := range []string{
+		"archive/tar",
+		"archive/zip",
+		"bufio",
+		"bytes",
+		"compress/bzip2",
+		"compress/gzip",
+		"compress/zlib",
+		"context",
+		"encoding/binary",
+		"encoding/hex",
+		"encoding/json",
+		"encoding/xml",
+		"errors",
+		"flag",
+		"fmt",
+		"github.com/jcorbin/xre",
+		"github.com/jcorbin/xre/internal/cmdutil",
+		"github.com/stretchr/testify/assert",
+		"github.com/stretchr/testify/require",
+		"go/ast",
+		"go/parser",
+		"go/token",
+		"io",
+		"io/ioutil",
+		"log",
+		"os",
+		"os/exec",
+		"os/signal",
+		"path",
+		"path/filepath",
+		"regexp",
+		"runtime",
+		"runtime/pprof",
+		"runtime/trace",
+		"sort",
+		"strconv",
+		"strings",
+		"sync",
+		"sync/atomic",
+		"syscall",
+		"testing",
+		"testing/iotest",
+		"time",
+		"unicode",
+	} {
+		_, def := counts[k]
+		assert.True(t, def, "expected output key %q", k)
+		delete(counts, k)
+	}
+	var extra []string
+	for k := range counts {
+		extra = append(extra, k)
+	}
+	sort.Strings(extra)
+	assert.Equal(t, []string(nil), extra, "unexpected extra output keys")
+}
+
 func countSep(s, sep []byte) map[string]int {
 	counts := make(map[string]int, 64)
 	for lines, i := bytes.Split(s, sep), 0; i < len(lines); i++ {
@@ -124,6 +154,7 @@ type intTestCase struct {
 	sysCmd []string
 	xreCmd string
 	listIn bool
+	status int // expected exit status of the built command, when no error
 	check  interface{}
 }
 
@@ -235,7 +266,13 @@ func (tc intTestCase) runExcmd(t *testing.T) {
 
 	errch := make(chan error, 1)
 	go func() {
-		errch <- xcmd.Wait()
+		err := xcmd.Wait()
+		if ee, ok := err.(*exec.ExitError); ok && tc.status != 0 && ee.ExitCode() == tc.status {
+			err = nil
+		} else if err == nil && tc.status != 0 {
+			err = fmt.Errorf("expected exit status %v", tc.status)
+		}
+		errch <- err
 	}()
 	tc.runCheck(t, opr, epr, errch)
 }
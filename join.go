@@ -52,6 +52,7 @@ type joinByteWriter struct {
 	first bool
 	w     io.Writer
 	bw    byteWriter
+	stats *outputStats
 }
 
 type joinStringProc struct {
@@ -66,6 +67,7 @@ type joinStringWriter struct {
 	tmp   bytes.Buffer
 	w     io.Writer
 	sw    stringWriter
+	stats *outputStats
 }
 
 type byteWriter interface {
@@ -91,6 +93,7 @@ func (j joinByte) Create(next Processor) Processor {
 			first: true,
 			w:     wr.w,
 			bw:    bw,
+			stats: wr.stats,
 		}
 	}
 	return &joinByteProc{sep: j, next: next}
@@ -104,6 +107,7 @@ func (j joinString) Create(next Processor) Processor {
 			first: true,
 			w:     wr.w,
 			sw:    sw,
+			stats: wr.stats,
 		}
 	}
 	return &joinStringProc{sep: j, next: next}
@@ -122,11 +126,13 @@ func (jp *joinProc) Process(buf []byte, last bool) error {
 }
 
 func (jp *joinByteProc) Process(buf []byte, last bool) error {
-	if jp.tmp.Len() > 0 {
-		jp.tmp.Grow(len(buf) + 1)
-		_ = jp.tmp.WriteByte(byte(jp.sep))
+	if buf != nil {
+		if jp.tmp.Len() > 0 {
+			jp.tmp.Grow(len(buf) + 1)
+			_ = jp.tmp.WriteByte(byte(jp.sep))
+		}
+		_, _ = jp.tmp.Write(buf)
 	}
-	_, _ = jp.tmp.Write(buf)
 	if !last {
 		return nil
 	}
@@ -136,11 +142,13 @@ func (jp *joinByteProc) Process(buf []byte, last bool) error {
 }
 
 func (jp *joinStringProc) Process(buf []byte, last bool) error {
-	if jp.tmp.Len() > 0 {
-		jp.tmp.Grow(len(buf) + len(jp.sep))
-		_, _ = jp.tmp.WriteString(string(jp.sep))
+	if buf != nil {
+		if jp.tmp.Len() > 0 {
+			jp.tmp.Grow(len(buf) + len(jp.sep))
+			_, _ = jp.tmp.WriteString(string(jp.sep))
+		}
+		_, _ = jp.tmp.Write(buf)
 	}
-	_, _ = jp.tmp.Write(buf)
 	if !last {
 		return nil
 	}
@@ -152,7 +160,7 @@ func (jp *joinStringProc) Process(buf []byte, last bool) error {
 func (jw *joinByteWriter) writeSep() error {
 	if jw.first {
 		jw.first = false
-		return nil
+		return jw.stats.add(1)
 	}
 	if jw.bw != nil {
 		return jw.bw.WriteByte(byte(jw.sep))
@@ -162,9 +170,11 @@ func (jw *joinByteWriter) writeSep() error {
 }
 
 func (jw *joinByteWriter) Process(buf []byte, last bool) error {
-	err := jw.writeSep()
-	if err == nil {
-		_, err = jw.w.Write(buf)
+	var err error
+	if buf != nil {
+		if err = jw.writeSep(); err == nil {
+			_, err = jw.w.Write(buf)
+		}
 	}
 	if last {
 		jw.first = true
@@ -175,7 +185,7 @@ func (jw *joinByteWriter) Process(buf []byte, last bool) error {
 func (jw *joinStringWriter) writeSep() error {
 	if jw.first {
 		jw.first = false
-		return nil
+		return jw.stats.add(1)
 	}
 	if jw.sw != nil {
 		_, err := jw.sw.WriteString(string(jw.sep))
@@ -188,9 +198,11 @@ func (jw *joinStringWriter) writeSep() error {
 }
 
 func (jw *joinStringWriter) Process(buf []byte, last bool) error {
-	err := jw.writeSep()
-	if err == nil {
-		_, err = jw.w.Write(buf)
+	var err error
+	if buf != nil {
+		if err = jw.writeSep(); err == nil {
+			_, err = jw.w.Write(buf)
+		}
 	}
 	if last {
 		jw.first = true
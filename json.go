@@ -0,0 +1,278 @@
+package xre
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// extractJSON extracts the raw bytes of every value selected by a path from
+// each of a (possibly concatenated, e.g. JSON Lines) stream of JSON values;
+// if unquote is set, selected strings are extracted unquoted.
+type extractJSON struct {
+	path    jsonPath
+	unquote bool
+}
+
+// jsonPath selects values within a JSON value, a step at a time: ".name"
+// selects an object member, ".*" every object member, "[N]" an array element,
+// and "[]" every array element; the empty path "." selects the whole value.
+type jsonPath []jsonStep
+
+type jsonStep struct {
+	kind  jsonStepKind
+	key   string
+	index int
+}
+
+type jsonStepKind uint8
+
+const (
+	jsonMember jsonStepKind = iota
+	jsonElement
+	jsonEveryMember
+	jsonEveryElement
+)
+
+func scanXJ(s string) (Command, string, error) {
+	xj := extractJSON{}
+	if len(s) > 0 && s[0] == '"' {
+		spec, rest, err := scanString(s[0], s[1:])
+		if err != nil {
+			return nil, rest, err
+		}
+		if xj.path, err = parseJSONPath(spec); err != nil {
+			return nil, rest, err
+		}
+		s = rest
+	}
+	if len(s) > 0 && s[0] == 'u' {
+		xj.unquote, s = true, s[1:]
+	}
+	return ProtoCommand{xj}, s, nil
+}
+
+func parseJSONPath(spec string) (jsonPath, error) {
+	if spec == "." || spec == "" {
+		return nil, nil
+	}
+	var path jsonPath
+	for s := spec; len(s) > 0; {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			i := strings.IndexAny(s, ".[")
+			if i < 0 {
+				i = len(s)
+			}
+			switch key := s[:i]; key {
+			case "":
+				return nil, fmt.Errorf("empty key in json path %q", spec)
+			case "*":
+				path = append(path, jsonStep{kind: jsonEveryMember})
+			default:
+				path = append(path, jsonStep{kind: jsonMember, key: key})
+			}
+			s = s[i:]
+		case '[':
+			i := strings.IndexByte(s, ']')
+			if i < 0 {
+				return nil, fmt.Errorf("unterminated [ in json path %q", spec)
+			}
+			if i == 1 {
+				path = append(path, jsonStep{kind: jsonEveryElement})
+			} else if n, err := strconv.Atoi(s[1:i]); err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid index %q in json path %q", s[1:i], spec)
+			} else {
+				path = append(path, jsonStep{kind: jsonElement, index: n})
+			}
+			s = s[i+1:]
+		default:
+			return nil, fmt.Errorf("invalid json path %q, expected . or [", spec)
+		}
+	}
+	return path, nil
+}
+
+func (jp jsonPath) String() string {
+	if len(jp) == 0 {
+		return "."
+	}
+	var sb strings.Builder
+	for _, step := range jp {
+		switch step.kind {
+		case jsonMember:
+			sb.WriteString("." + step.key)
+		case jsonElement:
+			fmt.Fprintf(&sb, "[%d]", step.index)
+		case jsonEveryMember:
+			sb.WriteString(".*")
+		case jsonEveryElement:
+			sb.WriteString("[]")
+		}
+	}
+	return sb.String()
+}
+
+func (xj extractJSON) String() string {
+	s := "xj"
+	if len(xj.path) > 0 {
+		s += stringSpec(xj.path.String())
+	}
+	if xj.unquote {
+		s += "u"
+	}
+	return s
+}
+
+func (xj extractJSON) Create(next Processor) Processor {
+	return &jsonProcessor{extractJSON: xj, next: next}
+}
+
+// jsonProcessor streams each input through a single json.Decoder, walking
+// into containers along the path a token at a time, so that only selected (or
+// skipped) values are ever held whole, and no input is scanned more than once.
+// Each selected value is held until the next one is decoded, or the input
+// ends, so that the last one may be processed as such; held values are never
+// slices of any buffer, since they're copied out (or unquoted) by the decoder.
+type jsonProcessor struct {
+	extractJSON
+	held    []byte
+	holding bool
+	next    Processor
+}
+
+func (jp jsonProcessor) String() string {
+	return fmt.Sprintf("%v %v", jp.extractJSON, jp.next)
+}
+
+func (jp *jsonProcessor) Process(buf []byte, last bool) error {
+	if buf == nil {
+		return nil
+	}
+	return jp.decode(bytes.NewReader(buf))
+}
+
+func (jp *jsonProcessor) ReadFrom(r io.Reader) (int64, error) {
+	cr := countingReader{r: r}
+	err := jp.decode(&cr)
+	return cr.n, err
+}
+
+func (jp *jsonProcessor) decode(r io.Reader) error {
+	jp.held, jp.holding = nil, false
+	dec := json.NewDecoder(r)
+	for {
+		err := jp.value(dec, jp.path)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			_ = jp.release(false)
+			if _, isSyntax := err.(*json.SyntaxError); isSyntax || err == io.ErrUnexpectedEOF {
+				return fmt.Errorf("invalid json: %v", err)
+			}
+			return err
+		}
+	}
+	return jp.release(true)
+}
+
+// release processes any held value, or a nil token if last and there's none.
+func (jp *jsonProcessor) release(last bool) error {
+	held, holding := jp.held, jp.holding
+	jp.held, jp.holding = nil, false
+	if !holding && !last {
+		return nil
+	}
+	return jp.next.Process(held, last)
+}
+
+// value processes every value selected by path within the next value read
+// from dec, returning io.EOF only if there's none.
+func (jp *jsonProcessor) value(dec *json.Decoder, path jsonPath) error {
+	if len(path) == 0 {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return err
+		}
+		return jp.yield(raw)
+	}
+
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	delim, isDelim := tok.(json.Delim)
+	if !isDelim {
+		// scalars have nothing to select within
+		return nil
+	}
+	step := path[0]
+	for i := 0; dec.More(); i++ {
+		selected := false
+		if delim == '{' {
+			tok, err := dec.Token()
+			if err != nil {
+				return midValue(err)
+			}
+			key, _ := tok.(string)
+			selected = step.kind == jsonEveryMember || step.kind == jsonMember && key == step.key
+		} else {
+			selected = step.kind == jsonEveryElement || step.kind == jsonElement && i == step.index
+		}
+		if selected {
+			err = jp.value(dec, path[1:])
+		} else {
+			var skip json.RawMessage
+			err = dec.Decode(&skip)
+		}
+		if err != nil {
+			return midValue(err)
+		}
+	}
+	_, err = dec.Token()
+	return midValue(err)
+}
+
+func (jp *jsonProcessor) yield(val []byte) error {
+	if jp.unquote && len(val) > 0 && val[0] == '"' {
+		var s string
+		if err := json.Unmarshal(val, &s); err != nil {
+			return err
+		}
+		val = []byte(s)
+	}
+	err := jp.release(false)
+	jp.held, jp.holding = val, true
+	return err
+}
+
+// midValue returns any error encountered after a value has started, with
+// io.EOF meaning that it was truncated.
+func midValue(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// countingReader counts the bytes read through it, and keeps returning any
+// read error, since json.Decoder.More drops any error it reads.
+type countingReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	if cr.err != nil {
+		return 0, cr.err
+	}
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	cr.err = err
+	return n, err
+}
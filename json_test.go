@@ -0,0 +1,132 @@
+package xre_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+var jsonLines = []byte(`{"items": [{"name": "a\"b", "n": 1}, {"name": "c"}]}
+{"items": [{"name": "d", "tags": ["x", "y"]}]}
+{"other": true}
+[1, 2.5, {"name": "e"}]
+`)
+
+// largeJSONArray returns a JSON array of n objects, along with the expected
+// output of extracting each of their names, one per line.
+func largeJSONArray(n int) (doc, names []byte) {
+	var d, o bytes.Buffer
+	d.WriteString(`{"items": [`)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			d.WriteString(", ")
+		}
+		fmt.Fprintf(&d, `{"name": "n%d", "tags": ["]", "}"], "n": %d}`, i, i)
+		fmt.Fprintf(&o, "n%d\n", i)
+	}
+	d.WriteString("]}\n")
+	return d.Bytes(), o.Bytes()
+}
+
+func Test_extractJSON_chunked(t *testing.T) {
+	doc, names := largeJSONArray(10000)
+	cmdTestCases{
+		{name: "large array one byte at a time",
+			cmd: `xj".items[].name"u p"\n"`,
+			in:  oneByteAtATime(doc),
+			out: names,
+		},
+		{name: "truncated",
+			cmd: `xj".items[].name"u p"\n"`,
+			in:  oneByteAtATime(doc[:len(doc)-3]),
+			out: names,
+			err: "invalid json: unexpected end of JSON input",
+		},
+		{name: "read error within an array",
+			cmd: `xj"[]" p"\n"`,
+			in:  readFixture("[1, 2,", errors.New("bang"), " 3", " 4]"),
+			out: []byte("1\n2\n"),
+			err: "bang",
+		},
+		{name: "number ending a read",
+			cmd: `xj p"\n"`,
+			in:  readFixture("12", "34 5", "6"),
+			out: []byte("1234\n56\n"),
+		},
+	}.run(t)
+}
+
+func Test_extractJSON(t *testing.T) {
+	cmdTestCases{
+		{name: "whole values",
+			cmd: `xj p"\n"`,
+			in:  []byte(`{"a": 1} [2,3]"four" 5`),
+			out: []byte(`{"a": 1}
+[2,3]
+"four"
+5
+`),
+		},
+		{name: "member names",
+			cmd: `xj".items[].name" p"\n"`,
+			in:  jsonLines,
+			out: []byte(`"a\"b"
+"c"
+"d"
+`),
+		},
+		{name: "unquoted member names",
+			cmd: `xj".items[].name"u p"\n"`,
+			in:  jsonLines,
+			out: []byte(`a"b
+c
+d
+`),
+		},
+		{name: "formatted and joined elements",
+			cmd: `xj"[]" p%"<%s>" j", "`,
+			in:  []byte("[1,2,3]\n"),
+			out: []byte(`<1>, <2>, <3>`),
+		},
+		{name: "joined member names",
+			cmd: `xj".items[].name"u j", " p"\n"`,
+			in:  jsonLines,
+			out: []byte("a\"b, c, d\n"),
+		},
+		{name: "array index",
+			cmd: `xj".items[1]" p"\n"`,
+			in:  jsonLines,
+			out: []byte(`{"name": "c"}
+`),
+		},
+		{name: "every member",
+			cmd: `xj".*" p"\n"`,
+			in:  jsonLines,
+			out: []byte(`[{"name": "a\"b", "n": 1}, {"name": "c"}]
+[{"name": "d", "tags": ["x", "y"]}]
+true
+`),
+		},
+		{name: "nested arrays",
+			cmd: `xj".items[].tags[]"u p"\n"`,
+			in:  jsonLines,
+			out: []byte(`x
+y
+`),
+		},
+		{name: "top level array",
+			cmd: `xj"[]" g/\./ p"\n"`,
+			in:  jsonLines,
+			out: []byte(`2.5
+`),
+		},
+		{name: "objects containing braces in strings",
+			cmd: `xj".a" p"\n"`,
+			in:  []byte(`{"a": "}{", "b": "\"}"}{"a": {"c": "]"}}`),
+			out: []byte(`"}{"
+{"c": "]"}
+`),
+		},
+	}.run(t)
+}
@@ -0,0 +1,128 @@
+package xre
+
+import (
+	"errors"
+	"io"
+	"strconv"
+)
+
+// extractLogfmt extracts the values of logfmt key=value pairs, like
+// `level=info msg="user logged in" user=42`, from each line; quoted values are
+// unquoted, honoring backslash escapes. If key is set, only its values are
+// extracted, including an empty value for any bare key without one.
+type extractLogfmt struct{ key string }
+
+func scanXK(s string) (Command, string, error) {
+	if len(s) == 0 || s[0] != '"' {
+		return ProtoCommand{extractLogfmt{}}, s, nil
+	}
+	key, s, err := scanString(s[0], s[1:])
+	if err == nil && key == "" {
+		err = errors.New("empty logfmt key")
+	}
+	return ProtoCommand{extractLogfmt{key}}, s, err
+}
+
+func (xk extractLogfmt) String() string {
+	if xk.key == "" {
+		return "xk"
+	}
+	return "xk" + stringSpec(xk.key)
+}
+
+func (xk extractLogfmt) Create(next Processor) Processor {
+	return &matchProcessor{next: next, matcher: xk}
+}
+
+// match processes the selected values of the next line in buf directly,
+// rather than through pushLoc, since unquoted values aren't slices of buf.
+func (xk extractLogfmt) match(mp *matchProcessor, buf []byte) error {
+	line, next, complete := nextLine(buf, 0)
+	if !complete && mp.buf.Err() != io.EOF {
+		return nil
+	}
+	if err := mp.procPrior(false); err != nil {
+		return err
+	}
+	err := scanLogfmt(line, func(key, val []byte, hasVal bool) error {
+		if xk.key == "" && hasVal || xk.key == string(key) {
+			return mp.yield(val, false)
+		}
+		return nil
+	})
+	mp.buf.Advance(next)
+	return err
+}
+
+// scanLogfmt calls each with every key and (unquoted) value pair in the given
+// line; hasVal is false for a bare key without any "=". Any stray "=" or quote
+// outside of a pair is skipped, as is any unterminated quote, with the rest of
+// the line taken as its value.
+func scanLogfmt(line []byte, each func(key, val []byte, hasVal bool) error) error {
+	for i := 0; i < len(line); {
+		if isLogfmtSpace(line[i]) {
+			i++
+			continue
+		}
+		start := i
+		for i < len(line) && !isLogfmtSpace(line[i]) && line[i] != '=' && line[i] != '"' {
+			i++
+		}
+		key := line[start:i]
+		if len(key) == 0 {
+			i++
+			continue
+		}
+		if i >= len(line) || line[i] != '=' {
+			if err := each(key, line[i:i], false); err != nil {
+				return err
+			}
+			continue
+		}
+		i++
+		start = i
+		var val []byte
+		if i < len(line) && line[i] == '"' {
+			for i++; i < len(line) && line[i] != '"'; i++ {
+				if line[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(line) {
+				i = len(line)
+				val = line[start+1 : i]
+			} else {
+				i++
+				val = unquoteLogfmt(line[start:i])
+			}
+		} else {
+			for i < len(line) && !isLogfmtSpace(line[i]) {
+				i++
+			}
+			val = line[start:i]
+		}
+		if err := each(key, val, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isLogfmtSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r'
+}
+
+// unquoteLogfmt unquotes a quoted value, returning its raw content if it has
+// no escapes, or any invalid ones.
+func unquoteLogfmt(quoted []byte) []byte {
+	raw := quoted[1 : len(quoted)-1]
+	for _, c := range raw {
+		if c == '\\' {
+			if s, err := strconv.Unquote(string(quoted)); err == nil {
+				return []byte(s)
+			}
+			break
+		}
+	}
+	return raw
+}
@@ -0,0 +1,47 @@
+package xre_test
+
+import "testing"
+
+var logfmtLines = []byte(`level=info msg="user \"bob\" logged in" user=42 debug
+level=warn msg=plain url=http://x/?a=b empty=
+level=error msg="bad \q escape" err="unterminated
+`)
+
+func Test_extractLogfmt(t *testing.T) {
+	cmdTestCases{
+		{name: "all values",
+			cmd: `xk p%"%q\n"`,
+			in:  logfmtLines,
+			out: []byte(`"info"
+"user \"bob\" logged in"
+"42"
+"warn"
+"plain"
+"http://x/?a=b"
+""
+"error"
+"bad \\q escape"
+"unterminated"
+`),
+		},
+		{name: "messages",
+			cmd: `xk"msg" p"\n"`,
+			in:  logfmtLines,
+			out: []byte(`user "bob" logged in
+plain
+bad \q escape
+`),
+		},
+		{name: "bare key",
+			cmd: `xk"debug" p%"%q\n"`,
+			in:  logfmtLines,
+			out: []byte(`""
+`),
+		},
+		{name: "filtered lines",
+			cmd: `y"\n" g/level=warn/ xk"url" p"\n"`,
+			in:  logfmtLines,
+			out: []byte("http://x/?a=b\n"),
+		},
+	}.run(t)
+}
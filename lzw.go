@@ -0,0 +1,215 @@
+package xre
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The compress(1) .Z format differs from what compress/lzw handles, so it
+// can't be decoded on top of it: codes may be up to 16 bits wide (rather than
+// 12), there's no EOF code (compress/lzw would stop at the first new code,
+// 257), a CLEAR code resets the table only in "block mode", and codes are
+// written in groups of 8, so that every code width change (or CLEAR) skips
+// ahead to the end of the current group. The decoding below follows that of
+// gzip's unlzw, e.g. in how widths grow.
+const (
+	lzwInitBits  = 9
+	lzwMaxBits   = 16
+	lzwClear     = 256
+	lzwFirst     = 257
+	lzwBlockMode = 0x80
+	lzwBitsMask  = 0x1f
+)
+
+var errLZWCorrupt = errors.New("compress: corrupt input")
+
+type unixLZWReader struct {
+	r io.ByteReader
+
+	// bit input state; since counts bits read since the current code group
+	// started
+	acc   uint32
+	nacc  uint
+	since int
+
+	maxBits uint
+	block   bool
+	nBits   uint
+	maxCode int
+	maxMax  int
+	freeEnt int
+	oldCode int
+	finChar byte
+	prefix  []uint16
+	suffix  []byte
+	stack   []byte
+	out     []byte
+	err     error
+}
+
+// newUnixLZWReader returns a reader decoding the compress(1) data read from r,
+// whose first two magic bytes have already been sniffed, but not consumed.
+func newUnixLZWReader(r io.ByteReader) (*unixLZWReader, error) {
+	var hdr [3]byte
+	for i := range hdr {
+		b, err := r.ReadByte()
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		hdr[i] = b
+	}
+	maxBits := uint(hdr[2] & lzwBitsMask)
+	if maxBits < lzwInitBits || maxBits > lzwMaxBits {
+		return nil, fmt.Errorf("compress: unsupported max code width %d", maxBits)
+	}
+	lr := &unixLZWReader{
+		r:       r,
+		maxBits: maxBits,
+		block:   hdr[2]&lzwBlockMode != 0,
+		nBits:   lzwInitBits,
+		maxCode: 1<<lzwInitBits - 1,
+		maxMax:  1 << maxBits,
+		oldCode: -1,
+		prefix:  make([]uint16, 1<<maxBits),
+		suffix:  make([]byte, 1<<maxBits),
+	}
+	for i := 0; i < 256; i++ {
+		lr.suffix[i] = byte(i)
+	}
+	lr.freeEnt = 256
+	if lr.block {
+		lr.freeEnt = lzwFirst
+	}
+	return lr, nil
+}
+
+func (lr *unixLZWReader) Read(p []byte) (int, error) {
+	for len(lr.out) == 0 && lr.err == nil {
+		lr.err = lr.decode()
+	}
+	n := copy(p, lr.out)
+	lr.out = lr.out[n:]
+	if n > 0 {
+		return n, nil
+	}
+	return 0, lr.err
+}
+
+// decode reads and decodes the next code, appending any resulting bytes to out.
+func (lr *unixLZWReader) decode() error {
+	if lr.freeEnt > lr.maxCode {
+		if err := lr.align(); err != nil {
+			return err
+		}
+		lr.nBits++
+		if lr.nBits == lr.maxBits {
+			lr.maxCode = lr.maxMax
+		} else {
+			lr.maxCode = 1<<lr.nBits - 1
+		}
+	}
+
+	code, err := lr.readCode()
+	if err != nil {
+		return err
+	}
+
+	if lr.oldCode == -1 {
+		if code >= 256 {
+			return errLZWCorrupt
+		}
+		lr.oldCode = code
+		lr.finChar = byte(code)
+		lr.out = append(lr.out[:0], lr.finChar)
+		return nil
+	}
+
+	if code == lzwClear && lr.block {
+		for i := range lr.prefix[:256] {
+			lr.prefix[i] = 0
+		}
+		lr.freeEnt = lzwFirst - 1
+		if err := lr.align(); err != nil {
+			return err
+		}
+		lr.nBits = lzwInitBits
+		lr.maxCode = 1<<lzwInitBits - 1
+		return nil
+	}
+
+	inCode := code
+	lr.stack = lr.stack[:0]
+	if code >= lr.freeEnt {
+		// the KwKwK case: code is the entry about to be defined
+		if code > lr.freeEnt {
+			return errLZWCorrupt
+		}
+		lr.stack = append(lr.stack, lr.finChar)
+		code = lr.oldCode
+	}
+	for code >= 256 {
+		lr.stack = append(lr.stack, lr.suffix[code])
+		code = int(lr.prefix[code])
+	}
+	lr.finChar = lr.suffix[code]
+	lr.stack = append(lr.stack, lr.finChar)
+
+	lr.out = lr.out[:0]
+	for i := len(lr.stack) - 1; i >= 0; i-- {
+		lr.out = append(lr.out, lr.stack[i])
+	}
+
+	if lr.freeEnt < lr.maxMax {
+		lr.prefix[lr.freeEnt] = uint16(lr.oldCode)
+		lr.suffix[lr.freeEnt] = lr.finChar
+		lr.freeEnt++
+	}
+	lr.oldCode = inCode
+	return nil
+}
+
+// readCode reads the next least-significant-bit first code of the current
+// width; any partial code at the end of input is just padding.
+func (lr *unixLZWReader) readCode() (int, error) {
+	for lr.nacc < lr.nBits {
+		b, err := lr.r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		lr.acc |= uint32(b) << lr.nacc
+		lr.nacc += 8
+	}
+	code := int(lr.acc & (1<<lr.nBits - 1))
+	lr.acc >>= lr.nBits
+	lr.nacc -= lr.nBits
+	lr.since += int(lr.nBits)
+	return code, nil
+}
+
+// align skips any remaining codes in the current group, starting a new one.
+func (lr *unixLZWReader) align() error {
+	group := int(lr.nBits) * 8
+	skip := (group - lr.since%group) % group
+	lr.since = 0
+	for skip > 0 {
+		if lr.nacc == 0 {
+			b, err := lr.r.ReadByte()
+			if err != nil {
+				return err
+			}
+			lr.acc, lr.nacc = uint32(b), 8
+		}
+		n := uint(skip)
+		if n > lr.nacc {
+			n = lr.nacc
+		}
+		lr.acc >>= n
+		lr.nacc -= n
+		skip -= int(n)
+	}
+	return nil
+}
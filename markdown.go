@@ -0,0 +1,223 @@
+package xre
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// extractMarkdown extracts structure from each whole Markdown document:
+// "section" for each (ATX) heading and its body, up to the next heading of
+// the same or higher level, "h1" through "h6" for only those sections at a
+// given level, and "code" for the content of each fenced code block. Headings
+// within code blocks are ignored.
+//
+// Sections may be filtered by their heading text, either exactly or by a
+// pattern; code blocks may be filtered by language.
+type extractMarkdown struct {
+	kind  string
+	level int
+	text  string
+	pat   *regexp.Regexp
+}
+
+func scanMarkdownSpec(kind, s string) (Command, string, error) {
+	xm := extractMarkdown{kind: kind}
+	switch kind {
+	case "section", "code":
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		xm.level = int(kind[1] - '0')
+	default:
+		return nil, s, fmt.Errorf("unrecognized x@md kind %q", kind)
+	}
+	if len(s) == 0 {
+		return ProtoCommand{xm}, s, nil
+	}
+	var err error
+	switch c := s[0]; c {
+	case '"':
+		xm.text, s, err = scanString(c, s[1:])
+		if err == nil && xm.text == "" {
+			err = errors.New("empty x@md filter")
+		}
+	case '/':
+		if kind == "code" {
+			return nil, s, errors.New("x@md:code may only be filtered by language string")
+		}
+		xm.pat, s, err = scanPat(c, s[1:])
+	}
+	return ProtoCommand{xm}, s, err
+}
+
+func (xm extractMarkdown) String() string {
+	s := "x@md:" + xm.kind
+	if xm.pat != nil {
+		return s + regexpString(xm.pat)
+	}
+	if xm.text != "" {
+		return s + stringSpec(xm.text)
+	}
+	return s
+}
+
+func (xm extractMarkdown) Create(next Processor) Processor {
+	return &matchProcessor{next: next, matcher: xm}
+}
+
+// match waits for the whole document, since a section extends until its next
+// peer heading, and then processes each selected section or code block
+// directly, since sections may be nested within each other.
+func (xm extractMarkdown) match(mp *matchProcessor, buf []byte) error {
+	if mp.buf.Err() != io.EOF {
+		return nil
+	}
+	if err := mp.procPrior(false); err != nil {
+		return err
+	}
+	err := scanMarkdown(buf, func(b mdBlock) error {
+		if !xm.selects(b) {
+			return nil
+		}
+		return mp.yield(buf[b.start:b.end], false)
+	})
+	mp.buf.Advance(len(buf))
+	return err
+}
+
+func (xm extractMarkdown) selects(b mdBlock) bool {
+	if (xm.kind == "code") != b.code {
+		return false
+	}
+	if xm.level > 0 && b.level != xm.level {
+		return false
+	}
+	switch {
+	case xm.pat != nil:
+		return xm.pat.MatchString(b.text)
+	case xm.text != "":
+		return xm.text == b.text
+	default:
+		return true
+	}
+}
+
+// mdBlock is a section or fenced code block within a Markdown document; text
+// is the section heading text, or the code language.
+type mdBlock struct {
+	start, end int
+	code       bool
+	level      int
+	text       string
+}
+
+// scanMarkdown calls each with every section and fenced code block in buf,
+// in order of their start.
+func scanMarkdown(buf []byte, each func(b mdBlock) error) error {
+	var (
+		blocks []mdBlock
+		open   []int // indices of sections that haven't ended yet
+		fence  []byte
+		code   mdBlock
+	)
+	for off := 0; off < len(buf); {
+		line, next, _ := nextLine(buf, off)
+		if fence != nil {
+			if isMarkdownFence(line, fence) {
+				code.end = off
+				blocks = append(blocks, code)
+				fence = nil
+			}
+		} else if f, lang := markdownFence(line); f != nil {
+			fence = f
+			code = mdBlock{start: next, end: len(buf), code: true, text: lang}
+		} else if level, text := markdownHeading(line); level > 0 {
+			for len(open) > 0 && blocks[open[len(open)-1]].level >= level {
+				blocks[open[len(open)-1]].end = off
+				open = open[:len(open)-1]
+			}
+			open = append(open, len(blocks))
+			blocks = append(blocks, mdBlock{start: off, end: len(buf), level: level, text: text})
+		}
+		off = next
+	}
+	if fence != nil {
+		blocks = append(blocks, code)
+	}
+	for _, b := range blocks {
+		if err := each(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markdownHeading returns the level and text of an ATX heading line, or a 0
+// level if the line isn't one.
+func markdownHeading(line []byte) (int, string) {
+	line = bytes.TrimRight(line, "\r")
+	if indentWidth(line) > 3 {
+		return 0, ""
+	}
+	line = bytes.TrimLeft(line, " ")
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 || level < len(line) && line[level] != ' ' && line[level] != '\t' {
+		return 0, ""
+	}
+	text := strings.TrimSpace(string(line[level:]))
+	if trimmed := strings.TrimRight(text, "#"); trimmed == "" {
+		text = ""
+	} else if trimmed != text && strings.HasSuffix(trimmed, " ") {
+		text = strings.TrimSpace(trimmed)
+	}
+	return level, text
+}
+
+// markdownFence returns the fence of a code block opening line, along with
+// its language, or a nil fence if the line isn't one.
+func markdownFence(line []byte) ([]byte, string) {
+	line = bytes.TrimRight(line, "\r")
+	if indentWidth(line) > 3 {
+		return nil, ""
+	}
+	line = bytes.TrimLeft(line, " ")
+	if len(line) == 0 || line[0] != '`' && line[0] != '~' {
+		return nil, ""
+	}
+	n := 0
+	for n < len(line) && line[n] == line[0] {
+		n++
+	}
+	info := line[n:]
+	if n < 3 || line[0] == '`' && bytes.IndexByte(info, '`') >= 0 {
+		return nil, ""
+	}
+	lang := ""
+	if fields := bytes.Fields(info); len(fields) > 0 {
+		lang = string(fields[0])
+	}
+	return line[:n], lang
+}
+
+// isMarkdownFence returns true if line closes a code block opened by fence: a
+// run of at least as many of the same fence characters, and nothing else.
+func isMarkdownFence(line, fence []byte) bool {
+	if indentWidth(line) > 3 {
+		return false
+	}
+	line = bytes.TrimSpace(line)
+	return len(line) >= len(fence) && len(bytes.TrimLeft(line, string(fence[:1]))) == 0
+}
+
+func indentWidth(line []byte) int {
+	n := 0
+	for n < len(line) && line[n] == ' ' {
+		n++
+	}
+	return n
+}
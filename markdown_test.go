@@ -0,0 +1,58 @@
+package xre_test
+
+import "testing"
+
+var markdownDoc = []byte("# Changelog\n\nIntro.\n\n" +
+	"## v1.1.0 ##\n\n- added x\n\n```sh\n# not a heading\necho hi\n```\n\n" +
+	"### Details\n\nmore\n\n" +
+	"## v1.0.0\n\n    # indented code, not a heading\n\n" +
+	"~~~~go\nfmt.Println(\"```\")\n~~~\nstill code\n~~~~\n\n#hashtag\n" +
+	"# Other\nend\n")
+
+func Test_extractMarkdown(t *testing.T) {
+	cmdTestCases{
+		{name: "nested sections",
+			cmd: `x@md:section g/Details/ x@md:section"Details" p%"%q\n"`,
+			in:  markdownDoc,
+			out: []byte(`"### Details\n\nmore\n\n"
+"### Details\n\nmore\n\n"
+"### Details\n\nmore\n\n"
+`),
+		},
+		{name: "sections within sections",
+			cmd: `x@md:section"Changelog" x@md:h2 x/v1\S+/ p"\n"`,
+			in:  markdownDoc,
+			out: []byte("v1.1.0\nv1.0.0\n"),
+		},
+		{name: "level 2 sections",
+			cmd: `x@md:h2 p%"%q\n"`,
+			in:  markdownDoc,
+			out: []byte(`"## v1.1.0 ##\n\n- added x\n\n` + "```sh\\n# not a heading\\necho hi\\n```" + `\n\n### Details\n\nmore\n\n"
+"## v1.0.0\n\n    # indented code, not a heading\n\n~~~~go\nfmt.Println(\"` + "```" + `\")\n~~~\nstill code\n~~~~\n\n#hashtag\n"
+`),
+		},
+		{name: "section by text",
+			cmd: `x@md:section"Details" p%"%q\n"`,
+			in:  markdownDoc,
+			out: []byte(`"### Details\n\nmore\n\n"
+`),
+		},
+		{name: "sections by pattern",
+			cmd: `x@md:h2/^v1\.1/ y"\n" g/^-/ p"\n"`,
+			in:  markdownDoc,
+			out: []byte("- added x\n"),
+		},
+		{name: "code blocks",
+			cmd: `x@md:code p%"%q\n"`,
+			in:  markdownDoc,
+			out: []byte(`"# not a heading\necho hi\n"
+"fmt.Println(\"` + "```" + `\")\n~~~\nstill code\n"
+`),
+		},
+		{name: "code blocks by language",
+			cmd: `x@md:code"sh" p`,
+			in:  markdownDoc,
+			out: []byte("# not a heading\necho hi\n"),
+		},
+	}.run(t)
+}
@@ -11,12 +11,19 @@ type matcher interface {
 	match(mp *matchProcessor, buf []byte) error
 }
 
+// matchResetter may be implemented by a stateful matcher to reset its state
+// before each new buffer or stream is processed.
+type matchResetter interface {
+	reset()
+}
+
 type matchProcessor struct {
 	matcher
 	buf      readBuf // TODO embed this also?
 	flushed  bool
 	pendLoc  bool
 	priorLoc [3]int
+	eager    bool
 	next     Processor
 }
 
@@ -25,17 +32,28 @@ func (mp matchProcessor) String() string {
 }
 
 func (mp *matchProcessor) Process(buf []byte, last bool) error {
-	mp.flushed = false
-	mp.pendLoc = false
-	mp.priorLoc = [3]int{0, 0, 0}
+	if buf == nil {
+		// A nil token is no structure, only the end of a stream whose last
+		// token was already processed, e.g. eagerly (see run); every
+		// structure processed already ended with a last token of our own.
+		return nil
+	}
+	mp.reset()
 	return mp.buf.ProcessIn(buf, mp.run)
 }
 
 func (mp *matchProcessor) ReadFrom(r io.Reader) (int64, error) {
+	mp.reset()
+	return mp.buf.ProcessFrom(r, mp.run)
+}
+
+func (mp *matchProcessor) reset() {
 	mp.flushed = false
 	mp.pendLoc = false
 	mp.priorLoc = [3]int{0, 0, 0}
-	return mp.buf.ProcessFrom(r, mp.run)
+	if mr, ok := mp.matcher.(matchResetter); ok {
+		mr.reset()
+	}
 }
 
 func (mp *matchProcessor) run(buf *readBuf) error {
@@ -77,6 +95,12 @@ func (mp *matchProcessor) run(buf *readBuf) error {
 	if berr != nil {
 		return mp.procPrior(false)
 	}
+	if mp.eager && mp.pendLoc && mp.priorLoc[1] < mp.priorLoc[2] {
+		// The pending token is complete, only whether it's the last one is
+		// unknown; rather than wait on more input that may be slow to come,
+		// process it now, and flush with a nil last token at EOF.
+		return mp.procPrior(false)
+	}
 	return nil
 }
 
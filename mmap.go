@@ -0,0 +1,62 @@
+package xre
+
+import (
+	"io"
+	"os"
+)
+
+// MmapLimit is the largest regular file input that is memory mapped, and
+// processed as a single buffer, rather than streamed through a read buffer; a
+// zero or negative limit disables memory mapping.
+var MmapLimit int64 = 1 << 30
+
+// mappedProcessor returns any Processor that may process a memory mapped
+// input whole in place of rf, i.e. one that extracts the same tokens from a
+// whole buffer as from a stream.
+func mappedProcessor(rf io.ReaderFrom) (proc Processor, ok bool) {
+	switch impl := rf.(type) {
+	case flushReaderFrom:
+		if proc, ok = mappedProcessor(impl.rf); ok {
+			proc = flushProc{proc, impl.flush}
+		}
+		return proc, ok
+	case writer, fmtWriter, delimWriter, procIOAdaptor:
+		// A writer streams its input through as-is, but would print a
+		// whole buffer as a single structure, e.g. formatted or delimited;
+		// similarly any adapted Processor sees each read as its own.
+		return nil, false
+	}
+	proc, ok = rf.(Processor)
+	return proc, ok
+}
+
+// processMapped processes the remaining content of the given input with proc
+// as a single buffer, if it's a regular file that may be memory mapped;
+// mapped is false if it may not be, and should be streamed instead.
+//
+// NOTE that, as with any memory mapped file, truncating the file while it's
+// being processed may crash the process.
+func processMapped(r io.Reader, proc Processor) (mapped bool, err error) {
+	f, isFile := r.(*os.File)
+	if !isFile || MmapLimit <= 0 {
+		return false, nil
+	}
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() ||
+		info.Size() == 0 || info.Size() > MmapLimit {
+		return false, nil
+	}
+	off, err := f.Seek(0, io.SeekCurrent)
+	if err != nil || off >= info.Size() {
+		return false, nil
+	}
+	data, err := mmap(f, int(info.Size()))
+	if err != nil {
+		return false, nil
+	}
+	err = proc.Process(data[off:], true)
+	if uerr := munmap(data); err == nil {
+		err = uerr
+	}
+	return true, err
+}
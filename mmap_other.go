@@ -0,0 +1,15 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package xre
+
+import (
+	"errors"
+	"os"
+)
+
+var errNoMmap = errors.New("memory mapping not supported")
+
+func mmap(f *os.File, size int) ([]byte, error) { return nil, errNoMmap }
+
+func munmap(data []byte) error { return errNoMmap }
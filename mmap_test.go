@@ -0,0 +1,177 @@
+package xre_test
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jcorbin/xre"
+)
+
+// pathRecorder records whether input was processed whole, or streamed.
+type pathRecorder struct {
+	processed []string
+	streamed  []string
+}
+
+func (pr *pathRecorder) Process(buf []byte, last bool) error {
+	pr.processed = append(pr.processed, string(buf))
+	return nil
+}
+
+func (pr *pathRecorder) ReadFrom(r io.Reader) (int64, error) {
+	buf, err := ioutil.ReadAll(r)
+	pr.streamed = append(pr.streamed, string(buf))
+	return int64(len(buf)), err
+}
+
+func TestRunReaderFrom_mmap(t *testing.T) {
+	defer func(prior int64) { xre.MmapLimit = prior }(xre.MmapLimit)
+
+	f, err := ioutil.TempFile("", "")
+	require.NoError(t, err, "unexpected tempfile error")
+	defer func() { _ = os.Remove(f.Name()) }()
+	_, err = f.WriteString("hello\nworld\n")
+	require.NoError(t, err, "unexpected write error")
+	require.NoError(t, f.Close(), "unexpected close error")
+
+	for _, tc := range []struct {
+		name      string
+		limit     int64
+		open      func(t *testing.T) io.Reader
+		processed []string
+		streamed  []string
+	}{
+		{
+			name:      "mapped",
+			limit:     1024,
+			processed: []string{"hello\nworld\n"},
+		},
+		{
+			name:     "disabled",
+			limit:    0,
+			streamed: []string{"hello\nworld\n"},
+		},
+		{
+			name:     "over limit",
+			limit:    4,
+			streamed: []string{"hello\nworld\n"},
+		},
+		{
+			name:  "mapped from offset",
+			limit: 1024,
+			open: func(t *testing.T) io.Reader {
+				f, err := os.Open(f.Name())
+				require.NoError(t, err, "unexpected open error")
+				_, err = f.Seek(6, io.SeekStart)
+				require.NoError(t, err, "unexpected seek error")
+				return f
+			},
+			processed: []string{"world\n"},
+		},
+		{
+			name:  "pipe",
+			limit: 1024,
+			open: func(t *testing.T) io.Reader {
+				pr, pw, err := os.Pipe()
+				require.NoError(t, err, "unexpected pipe error")
+				go func() {
+					_, _ = io.Copy(pw, strings.NewReader("hello\nworld\n"))
+					_ = pw.Close()
+				}()
+				return pr
+			},
+			streamed: []string{"hello\nworld\n"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			xre.MmapLimit = tc.limit
+			var r io.Reader
+			if tc.open != nil {
+				r = tc.open(t)
+			} else {
+				f, err := os.Open(f.Name())
+				require.NoError(t, err, "unexpected open error")
+				r = f
+			}
+			var be xre.BufEnv
+			be.SetInputs(r)
+			var rec pathRecorder
+			assert.NoError(t, xre.RunReaderFrom(&rec, &be), "unexpected run error")
+			assert.Equal(t, tc.processed, rec.processed, "expected processed input")
+			assert.Equal(t, tc.streamed, rec.streamed, "expected streamed input")
+		})
+	}
+}
+
+func TestRunCommand_mmap(t *testing.T) {
+	defer func(prior int64) { xre.MmapLimit = prior }(xre.MmapLimit)
+
+	f, err := ioutil.TempFile("", "")
+	require.NoError(t, err, "unexpected tempfile error")
+	defer func() { _ = os.Remove(f.Name()) }()
+	for i := 0; i < 10000; i++ {
+		_, err = f.WriteString("line with some words\n")
+		require.NoError(t, err, "unexpected write error")
+	}
+	require.NoError(t, f.Close(), "unexpected close error")
+
+	run := func(limit int64) string {
+		xre.MmapLimit = limit
+		in, err := os.Open(f.Name())
+		require.NoError(t, err, "unexpected open error")
+		var be xre.BufEnv
+		be.SetInputs(in)
+		require.NoError(t, xre.RunCommand(`y"\n" x/\w+/ j"," p";"`, &be), "unexpected run error")
+		return be.DefaultOutput.String()
+	}
+	streamed := run(0)
+	assert.Equal(t, streamed, run(1<<20), "expected mapped output to match streamed")
+}
+
+func TestRunCommand_mmapSameAsPipe(t *testing.T) {
+	defer func(prior int64) { xre.MmapLimit = prior }(xre.MmapLimit)
+	xre.MmapLimit = 1 << 20
+
+	const content = "a\nb\n"
+	f, err := ioutil.TempFile("", "")
+	require.NoError(t, err, "unexpected tempfile error")
+	defer func() { _ = os.Remove(f.Name()) }()
+	_, err = f.WriteString(content)
+	require.NoError(t, err, "unexpected write error")
+	require.NoError(t, f.Close(), "unexpected close error")
+
+	run := func(t *testing.T, prog string, in io.Reader) string {
+		var be xre.BufEnv
+		be.SetInputs(in)
+		require.NoError(t, xre.RunCommand(prog, &be), "unexpected run error")
+		return be.DefaultOutput.String()
+	}
+
+	for _, prog := range []string{
+		`p"|"`,
+		`p%"<%s>"`,
+		`j","`,
+		`y"\n" p"|"`,
+		`x/\w/ j"," p%"<%s>"`,
+	} {
+		t.Run(prog, func(t *testing.T) {
+			in, err := os.Open(f.Name())
+			require.NoError(t, err, "unexpected open error")
+			mapped := run(t, prog, in)
+
+			pr, pw, err := os.Pipe()
+			require.NoError(t, err, "unexpected pipe error")
+			go func() {
+				_, _ = io.WriteString(pw, content)
+				_ = pw.Close()
+			}()
+			assert.Equal(t, run(t, prog, pr), mapped, "expected file output to match pipe")
+		})
+	}
+}
@@ -50,7 +50,8 @@ type delimProc struct {
 }
 
 type writer struct {
-	w io.Writer
+	w     io.Writer
+	stats *outputStats
 }
 
 type fmtWriter struct {
@@ -89,12 +90,18 @@ func (wr writer) Create(nc Command, env Environment) (Processor, error) {
 }
 
 func (fp *fmtProc) Process(buf []byte, last bool) error {
+	if buf == nil {
+		return fp.next.Process(nil, last)
+	}
 	fp.tmp.Reset()
 	_, _ = fmt.Fprintf(&fp.tmp, fp.fmt, buf)
 	return fp.next.Process(fp.tmp.Bytes(), last)
 }
 
 func (dp *delimProc) Process(buf []byte, last bool) error {
+	if buf == nil {
+		return dp.next.Process(nil, last)
+	}
 	dp.tmp.Reset()
 	_, _ = dp.tmp.Write(buf)
 	_, _ = dp.tmp.Write(dp.delim)
@@ -105,6 +112,9 @@ func (wr writer) Process(buf []byte, last bool) error {
 	if buf == nil {
 		return nil
 	}
+	if err := wr.stats.add(1); err != nil {
+		return err
+	}
 	_, err := wr.w.Write(buf)
 	return err
 }
@@ -113,6 +123,9 @@ func (fw fmtWriter) Process(buf []byte, last bool) error {
 	if buf == nil {
 		return nil
 	}
+	if err := fw.stats.add(1); err != nil {
+		return err
+	}
 	_, err := fmt.Fprintf(fw.w, fw.fmt, buf)
 	return err
 }
@@ -121,6 +134,9 @@ func (dw delimWriter) Process(buf []byte, last bool) error {
 	if buf == nil {
 		return nil
 	}
+	if err := dw.stats.add(1); err != nil {
+		return err
+	}
 	_, err := dw.w.Write(buf)
 	if err == nil {
 		_, err = dw.w.Write(dw.delim)
@@ -132,8 +148,27 @@ func (dw delimWriter) Process(buf []byte, last bool) error {
 // Also implements for fmtWriter and delimWriter by embedding, so that they
 // degrade to ignoring the format/delim request when streaming (rather than
 // quote or format arbitrarily-sized read chunks).
+//
+// Any non-empty stream counts as a single structure.
 func (wr writer) ReadFrom(r io.Reader) (n int64, err error) {
-	return io.Copy(wr.w, r)
+	if wr.stats != nil && wr.stats.quit {
+		// no need to read past the first byte
+		var buf [1]byte
+		m, err := io.ReadFull(r, buf[:])
+		if m > 0 {
+			err = wr.stats.add(1)
+		} else if err == io.EOF {
+			err = nil
+		}
+		return int64(m), err
+	}
+	n, err = io.Copy(wr.w, r)
+	if n > 0 {
+		if serr := wr.stats.add(1); err == nil {
+			err = serr
+		}
+	}
+	return n, err
 }
 
 func (p printFormat) String() string  { return fmt.Sprintf("p%%%q", string(p)) }
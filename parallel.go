@@ -0,0 +1,290 @@
+package xre
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// ParallelOptions control RunCommandParallel.
+type ParallelOptions struct {
+	// Workers is how many inputs may be processed concurrently; it defaults
+	// to runtime.NumCPU().
+	Workers int
+
+	// Unordered allows each input's output to be written as soon as it's
+	// done, rather than in the order that inputs were received.
+	Unordered bool
+}
+
+func (opts ParallelOptions) workers() int {
+	if opts.Workers > 0 {
+		return opts.Workers
+	}
+	return runtime.NumCPU()
+}
+
+// InputError attributes an error to the named input that caused it.
+type InputError struct {
+	Name string
+	Err  error
+}
+
+func (ie InputError) Error() string { return ie.Name + ": " + ie.Err.Error() }
+
+// Unwrap returns the underlying error.
+func (ie InputError) Unwrap() error { return ie.Err }
+
+// inputError attributes err to the named input, unless it already is (e.g. an
+// *os.PathError for the same file).
+func inputError(name string, err error) error {
+	if err == nil || name == "" {
+		return err
+	}
+	switch e := err.(type) {
+	case *os.PathError:
+		if e.Path == name {
+			return err
+		}
+	case InputError:
+		if e.Name == name {
+			return err
+		}
+	}
+	return InputError{name, err}
+}
+
+// inputName returns the name of the given input, if its stream has one
+// (e.g. an *os.File), or the empty string otherwise.
+func inputName(in Input) string {
+	if nr, ok := in.ReadCloser.(interface{ Name() string }); ok {
+		return nr.Name()
+	}
+	return ""
+}
+
+// RunCommandParallel is like RunCommandContext, but processes several inputs
+// concurrently. Each worker gets its own processor built from the parsed
+// command, whose output is collected in memory and then written to the
+// environment's default processor, in input order unless opts.Unordered.
+//
+// Every input is processed independently, so any command state that would
+// normally carry over from one input to the next does not.
+//
+// Processing stops on the first error, which is attributed to its input by
+// an InputError when it has a name; under ordered output, all output from
+// prior inputs is written first.
+func RunCommandParallel(ctx context.Context, prog string, env Environment, opts ParallelOptions) (rerr error) {
+	defer func() {
+		if cerr := env.Close(); rerr == nil {
+			rerr = cerr
+		}
+	}()
+	return runParallel(ctx, prog, newParallelOutput(env), env.Inputs(), opts)
+}
+
+type parallelResult struct {
+	seq     int
+	name    string
+	out     []byte
+	count   int
+	err     error
+	isInput bool
+}
+
+// parallelEnv is the Environment that each parallel worker runs under,
+// collecting its output for later reassembly; any delim that the real
+// environment's default output terminates structures with is applied here,
+// since reassembled output is written raw.
+type parallelEnv struct {
+	out   bytes.Buffer
+	stats outputStats
+	delim []byte
+}
+
+func (pe *parallelEnv) Inputs() <-chan Input { return nil }
+func (pe *parallelEnv) Close() error         { return nil }
+
+func (pe *parallelEnv) Default() Processor {
+	wr := writer{&pe.out, &pe.stats}
+	if pe.delim != nil {
+		return delimWriter{pe.delim, wr}
+	}
+	return wr
+}
+
+func runParallel(ctx context.Context, prog string, out parallelOutput, ins <-chan Input, opts ParallelOptions) error {
+	n := opts.workers()
+
+	rfs := make([]io.ReaderFrom, n)
+	penvs := make([]*parallelEnv, n)
+	for i := range rfs {
+		cmd, err := ParseCommand(prog)
+		if err != nil {
+			return err
+		}
+		penvs[i] = &parallelEnv{delim: out.delim}
+		if rfs[i], err = BuildReaderFrom(cmd, penvs[i]); err != nil {
+			return err
+		}
+	}
+
+	var dispatcher, workers sync.WaitGroup
+	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		cancel()
+		dispatcher.Wait()
+		workers.Wait()
+	}()
+
+	type job struct {
+		seq int
+		in  Input
+	}
+
+	jobs := make(chan job)
+	results := make(chan parallelResult)
+
+	// limit how many results may be outstanding, so that memory use is
+	// bounded when waiting on a slow input to preserve order
+	window := make(chan struct{}, 2*n)
+
+	dispatcher.Add(1)
+	go func() {
+		defer dispatcher.Done()
+		defer close(jobs)
+		for seq := 0; ; seq++ {
+			select {
+			case <-ctx.Done():
+				return
+			case window <- struct{}{}:
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case in, ok := <-ins:
+				if !ok {
+					return
+				}
+				select {
+				case jobs <- job{seq, in}:
+				case <-ctx.Done():
+					if in.ReadCloser != nil {
+						_ = in.ReadCloser.Close()
+					}
+					return
+				}
+			}
+		}
+	}()
+
+	for i := range rfs {
+		workers.Add(1)
+		go func(rf io.ReaderFrom, penv *parallelEnv) {
+			defer workers.Done()
+			for j := range jobs {
+				res := parallelResult{seq: j.seq, name: inputName(j.in)}
+				penv.out.Reset()
+				penv.stats.n = 0
+				isInput, err := readInput(ctx, rf, j.in, out.handle != nil)
+				res.err = inputError(res.name, err)
+				res.isInput = isInput
+				res.count = penv.stats.n
+				if penv.out.Len() > 0 {
+					res.out = append([]byte(nil), penv.out.Bytes()...)
+				}
+				select {
+				case results <- res:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(rfs[i], penvs[i])
+	}
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
+
+	pending := make(map[int]parallelResult)
+	next := 0
+	for res := range results {
+		if opts.Unordered {
+			<-window
+			if err := out.write(res); err != nil {
+				return err
+			}
+			continue
+		}
+		pending[res.seq] = res
+		for {
+			res, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			<-window
+			if err := out.write(res); err != nil {
+				return err
+			}
+		}
+	}
+	return ctx.Err()
+}
+
+type parallelOutput struct {
+	proc   Processor
+	delim  []byte
+	stats  *outputStats
+	flush  func() error
+	handle func(error) error
+	done   func(name string) error
+}
+
+func newParallelOutput(env Environment) parallelOutput {
+	po := parallelOutput{proc: env.Default()}
+	if dw, ok := po.proc.(delimWriter); ok {
+		po.proc, po.delim = dw.writer, dw.delim
+	}
+	if wr, ok := po.proc.(writer); ok {
+		// count structures as reported by each worker, not reassembled chunks
+		po.proc, po.stats = writer{wr.w, nil}, wr.stats
+	}
+	if obs, ok := env.(inputObserver); ok {
+		po.done = obs.inputDone
+	}
+	if sf, ok := env.(structureFlusher); ok {
+		_, po.flush = sf.structureFlush()
+	}
+	if ieh, ok := env.(inputErrorHandler); ok {
+		po.handle = ieh.handleInputErrors()
+	}
+	return po
+}
+
+func (po parallelOutput) write(res parallelResult) error {
+	if err := po.stats.add(res.count); err != nil {
+		return err
+	}
+	if res.out != nil {
+		if err := po.proc.Process(res.out, false); err != nil {
+			return err
+		}
+		if po.flush != nil {
+			if err := po.flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if res.isInput && po.handle != nil {
+		return po.handle(res.err)
+	}
+	if res.err == nil && po.done != nil {
+		return po.done(res.name)
+	}
+	return res.err
+}
@@ -0,0 +1,82 @@
+package xre_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jcorbin/xre"
+)
+
+type namedReader struct {
+	io.Reader
+	name string
+}
+
+func (nr namedReader) Name() string { return nr.name }
+func (nr namedReader) Close() error { return nil }
+
+func parallelInputs(n int) ([]io.Reader, string) {
+	var want strings.Builder
+	rs := make([]io.Reader, n)
+	for i := range rs {
+		var in strings.Builder
+		for j := 0; j <= i%7; j++ {
+			fmt.Fprintf(&in, "input %v line %v\n", i, j)
+			if j%2 == 0 {
+				fmt.Fprintf(&want, "%v.%v;", i, j)
+			}
+		}
+		rs[i] = namedReader{strings.NewReader(in.String()), fmt.Sprintf("in%v", i)}
+	}
+	return rs, want.String()
+}
+
+const parallelTestProg = `y"\n" g/line \d*[02468]$/ x/\d+/ j"." p";"`
+
+func TestRunCommandParallel(t *testing.T) {
+	rs, want := parallelInputs(100)
+	var be xre.BufEnv
+	be.SetInputs(rs...)
+	err := xre.RunCommandParallel(context.Background(), parallelTestProg, &be, xre.ParallelOptions{Workers: 4})
+	assert.NoError(t, err, "unexpected parallel run error")
+	assert.Equal(t, want, be.DefaultOutput.String(), "expected ordered output")
+}
+
+func TestRunCommandParallel_unordered(t *testing.T) {
+	rs, want := parallelInputs(100)
+	var be xre.BufEnv
+	be.SetInputs(rs...)
+	err := xre.RunCommandParallel(context.Background(), parallelTestProg, &be, xre.ParallelOptions{
+		Workers:   4,
+		Unordered: true,
+	})
+	assert.NoError(t, err, "unexpected parallel run error")
+	sorted := func(s string) []string {
+		parts := strings.Split(s, ";")
+		sort.Strings(parts)
+		return parts
+	}
+	assert.Equal(t, sorted(want), sorted(be.DefaultOutput.String()), "expected all output")
+}
+
+func TestRunCommandParallel_error(t *testing.T) {
+	rs, _ := parallelInputs(20)
+	rs[10] = namedReader{readFixture("input 10 line 0\n", errors.New("bang")).Reader(), "in10"}
+	var be xre.BufEnv
+	be.SetInputs(rs...)
+	err := xre.RunCommandParallel(context.Background(), parallelTestProg, &be, xre.ParallelOptions{Workers: 4})
+	assert.EqualError(t, err, "in10: bang", "expected attributed error")
+	var ie xre.InputError
+	if assert.True(t, errors.As(err, &ie), "expected an InputError") {
+		assert.Equal(t, "in10", ie.Name, "expected error input name")
+	}
+	_, want := parallelInputs(10)
+	assert.Equal(t, want+"10.0;", be.DefaultOutput.String(), "expected output of all prior inputs")
+}
@@ -16,6 +16,10 @@ func (pp predicateProcessor) String() string {
 }
 
 func (pp predicateProcessor) Process(buf []byte, last bool) error {
+	if buf == nil {
+		// no structure to test, only the end of one
+		return pp.next.Process(nil, last)
+	}
 	if pp.predicate.test(buf) {
 		// FIXME may not observe last=true!
 		return pp.next.Process(buf, last)
@@ -0,0 +1,146 @@
+package xre
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var (
+	errTruncatedRecord = errors.New("truncated record")
+	errRecordTooLarge  = errors.New("record length too large")
+)
+
+// extractFixed extracts each fixed-size binary record, and any shorter one at
+// the end of input.
+type extractFixed struct{ size int }
+
+// extractPrefixed extracts the payload of each length-prefixed binary record,
+// with an unsigned big or little endian length header of width bytes, or a
+// uvarint (as used by e.g. delimited protobuf streams) if width is 0.
+type extractPrefixed struct {
+	width  int
+	little bool
+}
+
+// scanXHash parses a binary record command after its "x#": either a fixed
+// record size, like x#512, or a length header, like x#be2, x#le4, or x#uv.
+func scanXHash(s string) (Command, string, error) {
+	if strings.HasPrefix(s, "uv") {
+		return ProtoCommand{extractPrefixed{}}, s[2:], nil
+	}
+	var xp extractPrefixed
+	if strings.HasPrefix(s, "be") || strings.HasPrefix(s, "le") {
+		xp.little = s[0] == 'l'
+		n, rest, err := scanInt(s[2:])
+		if err != nil {
+			return nil, rest, err
+		}
+		switch n {
+		case 1, 2, 4, 8:
+		default:
+			return nil, rest, fmt.Errorf("invalid record length width %q, must be 1, 2, 4, or 8", s[:len(s)-len(rest)])
+		}
+		xp.width = n
+		return ProtoCommand{xp}, rest, nil
+	}
+	n, rest, err := scanInt(s)
+	if err == nil && (rest == s || n < 1) {
+		err = errors.New("expected record size, or be, le, or uv length header after x#")
+	}
+	return ProtoCommand{extractFixed{n}}, rest, err
+}
+
+func (xf extractFixed) String() string { return "x#" + strconv.Itoa(xf.size) }
+
+func (xp extractPrefixed) String() string {
+	switch {
+	case xp.width == 0:
+		return "x#uv"
+	case xp.little:
+		return "x#le" + strconv.Itoa(xp.width)
+	default:
+		return "x#be" + strconv.Itoa(xp.width)
+	}
+}
+
+func (xf extractFixed) Create(next Processor) Processor {
+	return &matchProcessor{next: next, matcher: xf}
+}
+func (xp extractPrefixed) Create(next Processor) Processor {
+	return &matchProcessor{next: next, matcher: xp}
+}
+
+func (xf extractFixed) match(mp *matchProcessor, buf []byte) error {
+	if len(buf) >= xf.size {
+		return mp.pushLoc(0, xf.size, xf.size)
+	}
+	if mp.buf.Err() == io.EOF {
+		return mp.pushLoc(0, len(buf), len(buf))
+	}
+	return nil
+}
+
+func (xp extractPrefixed) match(mp *matchProcessor, buf []byte) error {
+	atEOF := mp.buf.Err() == io.EOF
+	length, n := xp.length(buf)
+	if n < 0 {
+		return errRecordTooLarge
+	}
+	if n == 0 {
+		if atEOF {
+			return errTruncatedRecord
+		}
+		return nil
+	}
+	if length > uint64(len(buf)-n) {
+		if atEOF {
+			return errTruncatedRecord
+		}
+		if length > uint64(maxInt-n) {
+			return errRecordTooLarge
+		}
+		return nil
+	}
+
+	// The record is processed directly, rather than through pushLoc, since
+	// its header can't be matched again if the pending loc were forgotten at
+	// the end of the buffer.
+	if err := mp.procPrior(false); err != nil {
+		return err
+	}
+	end := n + int(length)
+	err := mp.yield(buf[n:end], false)
+	mp.buf.Advance(end)
+	return err
+}
+
+const maxInt = int(^uint(0) >> 1)
+
+// length decodes the length header at the start of buf, returning the number
+// of header bytes, 0 if buf is too short, or < 0 if the length overflows.
+func (xp extractPrefixed) length(buf []byte) (uint64, int) {
+	if xp.width == 0 {
+		return binary.Uvarint(buf)
+	}
+	if len(buf) < xp.width {
+		return 0, 0
+	}
+	var order binary.ByteOrder = binary.BigEndian
+	if xp.little {
+		order = binary.LittleEndian
+	}
+	switch xp.width {
+	case 1:
+		return uint64(buf[0]), 1
+	case 2:
+		return uint64(order.Uint16(buf)), 2
+	case 4:
+		return uint64(order.Uint32(buf)), 4
+	default:
+		return order.Uint64(buf), 8
+	}
+}
@@ -0,0 +1,38 @@
+package xre_test
+
+import "testing"
+
+func Test_records(t *testing.T) {
+	cmdTestCases{
+		{name: "fixed size",
+			cmd: `x#4 p"|"`,
+			in:  []byte("abcdefghij"),
+			out: []byte("abcd|efgh|ij|"),
+		},
+		{name: "big endian 2",
+			cmd: `x#be2 p"|"`,
+			in:  []byte("\x00\x03abc\x00\x00\x00\x02hi"),
+			out: []byte("abc||hi|"),
+		},
+		{name: "little endian 4",
+			cmd: `x#le4 p"|"`,
+			in:  []byte("\x03\x00\x00\x00abc\x02\x00\x00\x00hi"),
+			out: []byte("abc|hi|"),
+		},
+		{name: "single byte",
+			cmd: `x#be1 g/i/ p"|"`,
+			in:  []byte("\x03abc\x02hi"),
+			out: []byte("hi|"),
+		},
+		{name: "big endian 8",
+			cmd: `x#be8 p"|"`,
+			in:  []byte("\x00\x00\x00\x00\x00\x00\x00\x01a\x00\x00\x00\x00\x00\x00\x00\x02bc"),
+			out: []byte("a|bc|"),
+		},
+		{name: "uvarint",
+			cmd: `x#uv p%"%.3s|"`,
+			in:  append([]byte("\x03abc\x81\x01"), make([]byte, 129)...),
+			out: []byte("abc|\x00\x00\x00|"),
+		},
+	}.run(t)
+}
@@ -0,0 +1,224 @@
+package xre
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+)
+
+// ShardSize is the approximate size of each shard that RunCommandSharded
+// splits its input into; there are at least as many shards as workers.
+var ShardSize int64 = 16 * 1024 * 1024
+
+// RunCommandSharded is like RunCommandParallel, but for a single large input
+// that supports random access (e.g. a regular file). The input is split into
+// shards at top-level delimiter boundaries, which are processed concurrently
+// as if they were separate inputs, and whose output is concatenated.
+//
+// This is only possible when the command starts by splitting on a static
+// delimiter, e.g. `y"\n"`, where splitting from an arbitrary occurrence of
+// the delimiter finds the same structure as splitting from the start would;
+// furthermore any join over such top-level structure needs to see all of it,
+// and so precludes sharding. Otherwise the input is processed sequentially.
+//
+// Either way, the input is observed (e.g. counted under CountPerInput) as a
+// single whole input, rather than as each of its shards.
+func RunCommandSharded(ctx context.Context, prog string, env Environment, ra io.ReaderAt, size int64, opts ParallelOptions) (rerr error) {
+	defer func() {
+		if cerr := env.Close(); rerr == nil {
+			rerr = cerr
+		}
+	}()
+
+	cmd, err := ParseCommand(prog)
+	if err != nil {
+		return err
+	}
+
+	name := ""
+	if nr, ok := ra.(interface{ Name() string }); ok {
+		name = nr.Name()
+	}
+
+	delim, canShard := shardDelim(cmd)
+	if !canShard {
+		rf, err := BuildReaderFrom(cmd, env)
+		if err != nil {
+			return err
+		}
+		_, err = rf.ReadFrom(ctxReader{ctx, io.NewSectionReader(ra, 0, size)})
+		if obs, ok := env.(inputObserver); ok && err == nil {
+			err = obs.inputDone(name)
+		}
+		return inputError(name, err)
+	}
+
+	bounds, err := shardBounds(ra, size, delim, opts.workers())
+	if err != nil {
+		return inputError(name, err)
+	}
+
+	ins := make(chan Input, len(bounds))
+	for i, start := range bounds {
+		end := size
+		if j := i + 1; j < len(bounds) {
+			end = bounds[j]
+		}
+		ins <- Input{shardReader{
+			SectionReader: io.NewSectionReader(ra, start, end-start),
+			name:          fmt.Sprintf("%s@%d", name, start),
+		}, nil}
+	}
+	close(ins)
+
+	out := newParallelOutput(env)
+	if done := out.done; done != nil {
+		// results are written one at a time, so needn't synchronize
+		remaining := len(bounds)
+		out.done = func(string) error {
+			if remaining--; remaining > 0 {
+				return nil
+			}
+			return done(name)
+		}
+	}
+	return runParallel(ctx, prog, out, ins, opts)
+}
+
+type shardReader struct {
+	*io.SectionReader
+	name string
+}
+
+func (sr shardReader) Name() string { return sr.name }
+func (sr shardReader) Close() error { return nil }
+
+// shardDelim returns the delimiter that the given command's input may be
+// sharded at, if any.
+func shardDelim(cmd Command) ([]byte, bool) {
+	var tail []Command
+	if cc, isChain := cmd.(commandChain); isChain && len(cc) > 0 {
+		cmd, tail = cc[0], cc[1:]
+	}
+
+	pc, isProto := cmd.(ProtoCommand)
+	if !isProto {
+		return nil, false
+	}
+	bds, isSplit := pc.ProtoProcessor.(betweenDelimSplit)
+	if !isSplit || bds.retain == retainPrefix {
+		// prefix tokens start at a delimiter, rather than after one
+		return nil, false
+	}
+
+	delim, ok := splitDelim(bds.split)
+	if !ok {
+		return nil, false
+	}
+	if selfOverlaps(delim) {
+		return nil, false
+	}
+
+	// scan the commands that process top-level structure, up to the first
+	// one that extracts sub-structure from it
+	for _, c := range tail {
+		pc, isProto := c.(ProtoCommand)
+		if !isProto {
+			continue
+		}
+		switch pc.ProtoProcessor.(type) {
+		case join, joinByte, joinString:
+			return nil, false
+		case matcher:
+			return delim, true
+		}
+	}
+	return delim, true
+}
+
+// splitDelim returns the delimiter that the given splitter splits at, if
+// it's well defined.
+func splitDelim(sp splitter) ([]byte, bool) {
+	switch impl := sp.(type) {
+	case lineSplitter:
+		if impl.n != 1 {
+			// runs of newlines are split differently, depending on where
+			// within them splitting starts
+			return nil, false
+		}
+		// any newline ends a line, regardless of any preceding carriage
+		// return, or other line terminators
+		return []byte{'\n'}, true
+	case byteSplitter:
+		return []byte{byte(impl)}, true
+	case bytesSplitter:
+		return impl, true
+	case byteSplitTrimmer:
+		return []byte{impl.delim}, true
+	case bytesSplitTrimmer:
+		return impl.delim, true
+	case splitTrimmer:
+		return splitDelim(impl.splitter)
+	default:
+		return nil, false
+	}
+}
+
+// selfOverlaps returns true if any proper prefix of delim is also a suffix,
+// in which case occurrences found by searching from an arbitrary offset may
+// not be the same ones found by searching from the start.
+func selfOverlaps(delim []byte) bool {
+	for k := 1; k < len(delim); k++ {
+		if bytes.Equal(delim[:k], delim[len(delim)-k:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// shardBounds returns the starting offset of every shard: the first at 0,
+// and then each just after the first delimiter found past evenly spaced
+// offsets.
+func shardBounds(ra io.ReaderAt, size int64, delim []byte, workers int) ([]int64, error) {
+	n := (size + ShardSize - 1) / ShardSize
+	if n < int64(workers) {
+		n = int64(workers)
+	}
+	bounds := []int64{0}
+	buf := make([]byte, MinRead+len(delim)-1)
+	for i := int64(1); i < n; i++ {
+		off := i * size / n
+		if prior := bounds[len(bounds)-1]; off < prior {
+			off = prior
+		}
+		found, err := findDelim(ra, size, delim, off, buf)
+		if err != nil {
+			return nil, err
+		}
+		if found < 0 {
+			break
+		}
+		if found += int64(len(delim)); found < size && found > bounds[len(bounds)-1] {
+			bounds = append(bounds, found)
+		}
+	}
+	return bounds, nil
+}
+
+func findDelim(ra io.ReaderAt, size int64, delim []byte, off int64, buf []byte) (int64, error) {
+	for off < size {
+		n, err := ra.ReadAt(buf, off)
+		if err != nil && err != io.EOF {
+			return -1, err
+		}
+		if i := bytes.Index(buf[:n], delim); i >= 0 {
+			return off + int64(i), nil
+		}
+		if err == io.EOF || n < len(delim) {
+			break
+		}
+		off += int64(n - len(delim) + 1)
+	}
+	return -1, nil
+}
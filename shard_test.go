@@ -0,0 +1,109 @@
+package xre_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jcorbin/xre"
+)
+
+func TestRunCommandSharded(t *testing.T) {
+	defer func(prior int64) { xre.ShardSize = prior }(xre.ShardSize)
+	xre.ShardSize = 100
+
+	var input bytes.Buffer
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&input, "line %v: %v\n", i, i%3 == 0)
+		if i%10 == 9 {
+			input.WriteString("---\n")
+		}
+	}
+	data := input.Bytes()
+
+	for _, tc := range []struct {
+		prog   string
+		shards bool
+	}{
+		{`y"\n" g/true/ x/\d+/ p","`, true},
+		{`y"---\n" y"\n" x/^line (\d+)/ j"+" p"\n"`, true},
+		{`y"\n\n" p"|"`, false},
+		{`y"\n" x/\d+/ j","`, true},
+		{`y"\n" j","`, false},
+		{`y"\n"ru~" " g/true/ p","`, true},
+		{`y"---\n"+ p"|"`, true},
+		{`y+"---\n" y"\n" x/\d+/ j"+" p"\n"`, false},
+	} {
+		prog := tc.prog
+		t.Run(prog, func(t *testing.T) {
+			var want xre.BufEnv
+			cmd, err := xre.ParseCommand(prog)
+			require.NoError(t, err, "unexpected parse error")
+
+			delim, canShard := xre.ShardDelim(cmd)
+			if assert.Equal(t, tc.shards, canShard, "expected shardability") && canShard {
+				bounds, err := xre.ShardBounds(bytes.NewReader(data), int64(len(data)), delim, 3)
+				require.NoError(t, err, "unexpected shard bounds error")
+				assert.True(t, len(bounds) > 1, "expected several shards, got %v", bounds)
+			}
+
+			rf, err := xre.BuildReaderFrom(cmd, &want)
+			require.NoError(t, err, "unexpected build error")
+			_, err = want.RunReaderFrom(rf, bytes.NewReader(data))
+			require.NoError(t, err, "unexpected sequential run error")
+
+			var be xre.BufEnv
+			err = xre.RunCommandSharded(context.Background(), prog, &be,
+				bytes.NewReader(data), int64(len(data)),
+				xre.ParallelOptions{Workers: 3})
+			assert.NoError(t, err, "unexpected sharded run error")
+			assert.Equal(t, want.DefaultOutput.String(), be.DefaultOutput.String(), "expected same output as sequential")
+		})
+	}
+}
+
+func TestRunCommandSharded_CountPerInput(t *testing.T) {
+	defer func(prior int64) { xre.ShardSize = prior }(xre.ShardSize)
+	xre.ShardSize = 100
+
+	in, err := ioutil.TempFile("", "")
+	require.NoError(t, err, "unexpected tempfile error")
+	defer func() {
+		_ = in.Close()
+		_ = os.Remove(in.Name())
+	}()
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(in, "line %v: %v\n", i, i%3 == 0)
+	}
+	info, err := in.Stat()
+	require.NoError(t, err, "unexpected stat error")
+
+	for _, prog := range []string{
+		`y"\n" g/true/`,
+		`y"\n\n" y"\n" g/true/`,
+	} {
+		t.Run(prog, func(t *testing.T) {
+			out, err := ioutil.TempFile("", "")
+			require.NoError(t, err, "unexpected tempfile error")
+			defer func() { _ = os.Remove(out.Name()) }()
+
+			fe := xre.FileEnv{
+				DefaultOutfile: out,
+				Count:          xre.CountPerInput,
+			}
+			err = xre.RunCommandSharded(context.Background(), prog, &fe,
+				in, info.Size(), xre.ParallelOptions{Workers: 3})
+			assert.NoError(t, err, "unexpected sharded run error")
+
+			b, err := ioutil.ReadFile(out.Name())
+			assert.NoError(t, err, "unexpected read file error")
+			assert.Equal(t, in.Name()+":67\n", string(b), "expected one count for the whole input")
+		})
+	}
+}
@@ -4,14 +4,6 @@ import "bytes"
 
 func trimmedSplitter(sp splitter, cutset string) splitter {
 	switch impl := sp.(type) {
-	case lineSplitter:
-		// TODO would do better to leverage a generic one around lineSpliter,
-		// or even just ignore if cutset is just \r and/or \n
-		if impl == 1 {
-			return byteSplitTrimmer{'\n', cutset}
-		}
-		return bytesSplitTrimmer{bytes.Repeat([]byte{'\n'}, int(impl)), cutset}
-
 	case byteSplitter:
 		return byteSplitTrimmer{byte(impl), cutset}
 
@@ -19,11 +11,33 @@ func trimmedSplitter(sp splitter, cutset string) splitter {
 		return bytesSplitTrimmer{impl, cutset}
 
 	default:
-		panic("generic split trimming not implemented")
+		return splitTrimmer{sp, cutset}
+	}
+}
+
+// untrimmedSplitter returns the splitter underlying any trimming one, along
+// with its cutset.
+func untrimmedSplitter(sp splitter) (splitter, string) {
+	switch impl := sp.(type) {
+	case byteSplitTrimmer:
+		return byteSplitter(impl.delim), impl.cutset
+	case bytesSplitTrimmer:
+		return bytesSplitter(impl.delim), impl.cutset
+	case splitTrimmer:
+		return impl.splitter, impl.cutset
+	default:
+		return sp, ""
 	}
 }
 
-type lineSplitter int
+// lineSplitter splits at runs of n line terminators: a newline, optionally
+// preceded by a carriage return; if cr is set, also a lone carriage return,
+// and if unicode is set, also the U+2028 line and U+2029 paragraph separators.
+type lineSplitter struct {
+	n           int
+	cr, unicode bool
+}
+
 type byteSplitter byte
 type bytesSplitter []byte
 type byteSplitTrimmer struct {
@@ -35,16 +49,20 @@ type bytesSplitTrimmer struct {
 	cutset string
 }
 
+// splitTrimmer trims the tokens of any other splitter.
+type splitTrimmer struct {
+	splitter
+	cutset string
+}
+
 func (ls lineSplitter) Split(data []byte, atEOF bool) (advance int, token []byte, err error) {
 	if atEOF && len(data) == 0 {
 		return 0, nil, nil
 	}
 
-	// TODO CR support
-
 attempt:
 	for off := 0; ; {
-		i := bytes.IndexByte(data[off:], '\n')
+		i, n := ls.index(data[off:], atEOF)
 		if i < 0 {
 			if atEOF {
 				return len(data), data, nil
@@ -52,19 +70,70 @@ attempt:
 			return 0, nil, nil
 		}
 		i += off
-		j := i + 1
-		for n := 1; n < int(ls) && j < len(data); n++ {
-			if data[j] == '\n' {
-				j++
-			} else {
+		j := i + n
+		for k := 1; k < ls.n; k++ {
+			if j >= len(data) {
+				if atEOF {
+					break
+				}
+				return 0, nil, nil
+			}
+			ii, nn := ls.index(data[j:], atEOF)
+			if ii < 0 && !atEOF {
+				return 0, nil, nil
+			} else if ii != 0 {
 				off = j
 				continue attempt
 			}
+			j += nn
 		}
 		return j, data[0:i], nil
 	}
 }
 
+// index returns the index and width of the first line terminator in data, or
+// a negative index if there's none, or if more data is needed to tell.
+func (ls lineSplitter) index(data []byte, atEOF bool) (int, int) {
+	for off := 0; ; {
+		var i int
+		switch {
+		case ls.unicode:
+			i = bytes.IndexAny(data[off:], "\r\n\u2028\u2029")
+		case ls.cr:
+			i = bytes.IndexAny(data[off:], "\r\n")
+		default:
+			i = bytes.IndexByte(data[off:], '\n')
+		}
+		if i < 0 {
+			return i, 0
+		}
+		i += off
+		switch data[i] {
+		case '\n':
+			if i > 0 && data[i-1] == '\r' {
+				return i - 1, 2
+			}
+			return i, 1
+		case '\r':
+			if i+1 < len(data) {
+				if data[i+1] == '\n' {
+					return i, 2
+				}
+				if ls.cr {
+					return i, 1
+				}
+			} else if !atEOF {
+				return -1, 0
+			} else if ls.cr {
+				return i, 1
+			}
+			off = i + 1
+		default:
+			return i, len("\u2028")
+		}
+	}
+}
+
 func (bs byteSplitter) Split(data []byte, atEOF bool) (advance int, token []byte, err error) {
 	if atEOF && len(data) == 0 {
 		return 0, nil, nil
@@ -96,10 +165,10 @@ func (bst byteSplitTrimmer) Split(data []byte, atEOF bool) (advance int, token [
 		return 0, nil, nil
 	}
 	if i := bytes.IndexByte(data, bst.delim); i >= 0 {
-		return i + 1, bytes.Trim(data[0:i], bst.cutset), nil
+		return i + 1, trim(data[0:i], bst.cutset), nil
 	}
 	if atEOF {
-		return len(data), bytes.Trim(data, bst.cutset), nil
+		return len(data), trim(data, bst.cutset), nil
 	}
 	return 0, nil, nil
 }
@@ -109,10 +178,26 @@ func (bsst bytesSplitTrimmer) Split(data []byte, atEOF bool) (advance int, token
 		return 0, nil, nil
 	}
 	if i := bytes.Index(data, bsst.delim); i >= 0 {
-		return i + len(bsst.delim), bytes.Trim(data[0:i], bsst.cutset), nil
+		return i + len(bsst.delim), trim(data[0:i], bsst.cutset), nil
 	}
 	if atEOF {
-		return len(data), bytes.Trim(data, bsst.cutset), nil
+		return len(data), trim(data, bsst.cutset), nil
 	}
 	return 0, nil, nil
 }
+
+func (st splitTrimmer) Split(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	advance, token, err = st.splitter.Split(data, atEOF)
+	if token != nil {
+		token = trim(token, st.cutset)
+	}
+	return advance, token, err
+}
+
+// trim is bytes.Trim, but returns an empty token rather than nil.
+func trim(token []byte, cutset string) []byte {
+	if trimmed := bytes.Trim(token, cutset); trimmed != nil {
+		return trimmed
+	}
+	return token[:0]
+}
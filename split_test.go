@@ -81,5 +81,64 @@ func Test_splitters(t *testing.T) {
 			"slag slug"
 			`),
 		},
+
+		{name: "crlf lines",
+			cmd: `y"\n" g/b$/ p"\n"`,
+			in:  []byte("ab\r\ncb\r\nbc\r\n"),
+			out: []byte("ab\ncb\n"),
+		},
+
+		{name: "lone cr lines",
+			cmd: `y"\n"r p%"%q\n"`,
+			in:  []byte("a\rb\r\nc\n\rd\r"),
+			out: stripBlockSpace(`
+			"a"
+			"b"
+			"c"
+			""
+			"d"
+			`),
+		},
+
+		{name: "unicode lines",
+			cmd: `y"\n"u p%"%q\n"`,
+			in:  []byte("a\u2028b\u2029c\r\nd\re"),
+			out: stripBlockSpace(`
+			"a"
+			"b"
+			"c"
+			"d\re"
+			`),
+		},
+
+		{name: "crlf paragraphs",
+			cmd: `y"\n\n" p%"%q\n"`,
+			in:  []byte("a\r\nb\r\n\r\nc\n\r\nd\r\n"),
+			out: stripBlockSpace(`
+			"a\r\nb"
+			"c"
+			"d"
+			`),
+		},
+
+		{name: "lone cr paragraphs",
+			cmd: `y"\n\n"r p%"%q\n"`,
+			in:  []byte("a\rb\r\rc\r\n\rd"),
+			out: stripBlockSpace(`
+			"a\rb"
+			"c"
+			"d"
+			`),
+		},
+
+		{name: "trimmed crlf lines",
+			cmd: `y"\n"~" " p%"%q\n"`,
+			in:  []byte(" a \r\n\r\n b\r\n"),
+			out: stripBlockSpace(`
+			"a"
+			""
+			"b"
+			`),
+		},
 	}.run(t)
 }
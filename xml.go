@@ -0,0 +1,150 @@
+package xre
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// extractElement extracts each outermost XML (or HTML) element with a given tag
+// name, while betweenElement extracts only their inner content. Names are
+// matched case insensitively, with or without any namespace prefix; comments,
+// CDATA sections, and self-closing tags are all handled by encoding/xml's
+// tokenizer, run in its non-strict mode.
+type extractElement struct{ name string }
+type betweenElement extractElement
+
+// scanElementSpec parses the rest of an element command after its opening
+// "<", returning ok=false if s doesn't start with a tag name followed by ">".
+func scanElementSpec(s string) (name, rest string, ok bool) {
+	i := 0
+	for i < len(s) && isElementNameByte(s[i], i == 0) {
+		i++
+	}
+	if i == 0 || i == len(s) || s[i] != '>' {
+		return "", s, false
+	}
+	return s[:i], s[i+1:], true
+}
+
+func isElementNameByte(c byte, first bool) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', c == '_':
+		return true
+	case '0' <= c && c <= '9', c == '-', c == '.', c == ':':
+		return !first
+	default:
+		return false
+	}
+}
+
+func (xe extractElement) String() string { return fmt.Sprintf("x<%s>", xe.name) }
+func (ye betweenElement) String() string { return fmt.Sprintf("y<%s>", ye.name) }
+
+func (xe extractElement) Create(next Processor) Processor {
+	return &matchProcessor{next: next, matcher: xe}
+}
+func (ye betweenElement) Create(next Processor) Processor {
+	return &matchProcessor{next: next, matcher: ye}
+}
+
+func (xe extractElement) match(mp *matchProcessor, buf []byte) error {
+	loc, found, err := scanElement(xe.name, mp, buf)
+	if found {
+		return mp.pushLoc(loc[0], loc[3], loc[3])
+	}
+	return err
+}
+
+func (ye betweenElement) match(mp *matchProcessor, buf []byte) error {
+	loc, found, err := scanElement(ye.name, mp, buf)
+	if !found {
+		return err
+	}
+	if loc[2] == loc[3] {
+		// A self-closing element's empty content ends where it does; it's
+		// processed directly, since a pending loc ending the buffer would be
+		// forgotten, and couldn't be matched again from after its start tag.
+		if err := mp.procPrior(false); err != nil {
+			return err
+		}
+		err := mp.yield(buf[loc[1]:loc[2]], false)
+		mp.buf.Advance(loc[3])
+		return err
+	}
+	return mp.pushLoc(loc[1], loc[2], loc[3])
+}
+
+// scanElement finds the first outermost element with the given name in buf,
+// returning the start and end of its start tag, followed by the start and end
+// of its end tag. If none is found, any content before the last token boundary
+// outside of such an element is skipped, so that it needn't be scanned again.
+func scanElement(name string, mp *matchProcessor, buf []byte) (loc [4]int, found bool, err error) {
+	dec := xml.NewDecoder(bytes.NewReader(buf))
+	dec.Strict = false
+	dec.Entity = xml.HTMLEntity
+
+	level, safe := 0, 0
+	for {
+		off := int(dec.InputOffset())
+		if level == 0 {
+			safe = off
+		}
+		tok, err := dec.RawToken()
+		if err != nil {
+			if err != io.EOF && !isXMLTruncation(err, dec, buf, mp.buf.Err() == io.EOF) {
+				return loc, false, fmt.Errorf("invalid xml: %v", err)
+			}
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if elementNameIs(t.Name, name) {
+				if level == 0 {
+					loc[0] = off
+					loc[1] = int(dec.InputOffset())
+				}
+				level++
+			}
+		case xml.EndElement:
+			if elementNameIs(t.Name, name) && level > 0 {
+				if level--; level == 0 {
+					loc[2] = off
+					loc[3] = int(dec.InputOffset())
+					return loc, true, nil
+				}
+			}
+		}
+	}
+
+	if safe > 0 {
+		if err := mp.procPrior(false); err != nil {
+			return loc, false, err
+		}
+		mp.buf.Advance(safe)
+	}
+	return loc, false, nil
+}
+
+func elementNameIs(n xml.Name, name string) bool {
+	if n.Space != "" && strings.EqualFold(n.Space+":"+n.Local, name) {
+		return true
+	}
+	return strings.EqualFold(n.Local, name)
+}
+
+// isXMLTruncation returns true if err may be due to the tokenizer running out
+// of input, rather than invalid content: before EOF, any error after consuming
+// all of buf may be resolved by more input.
+func isXMLTruncation(err error, dec *xml.Decoder, buf []byte, atEOF bool) bool {
+	se, ok := err.(*xml.SyntaxError)
+	if !ok {
+		return false
+	}
+	if atEOF {
+		return strings.HasPrefix(se.Msg, "unexpected EOF")
+	}
+	return int(dec.InputOffset()) == len(buf)
+}
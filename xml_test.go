@@ -0,0 +1,79 @@
+package xre_test
+
+import "testing"
+
+var xmlDoc = []byte(`<?xml version="1.0"?>
+<!DOCTYPE html>
+<html><body>
+<!-- <item>not this</item> -->
+<list>
+  <item id=1>one &amp; <b>bold</b></item>
+  <ITEM/>
+  <item><![CDATA[ <item>nested?</item> ]]></item>
+  <item><item>inner</item> outer</item>
+  <x:item>ns</x:item>
+</list>
+<p>para<br>break</p>
+</body></html>
+`)
+
+func Test_element(t *testing.T) {
+	cmdTestCases{
+		{name: "extract elements",
+			cmd: `x<item> p%"%q\n"`,
+			in:  xmlDoc,
+			out: []byte(`"<item id=1>one &amp; <b>bold</b></item>"
+"<ITEM/>"
+"<item><![CDATA[ <item>nested?</item> ]]></item>"
+"<item><item>inner</item> outer</item>"
+"<x:item>ns</x:item>"
+`),
+		},
+		{name: "between elements",
+			cmd: `y<item> p%"%q\n"`,
+			in:  xmlDoc,
+			out: []byte(`"one &amp; <b>bold</b>"
+""
+"<![CDATA[ <item>nested?</item> ]]>"
+"<item>inner</item> outer"
+"ns"
+`),
+		},
+		{name: "extract elements one byte at a time",
+			cmd: `x<item> p%"%q\n"`,
+			in:  oneByteAtATime("x<item/><item>a</item><item/>"),
+			out: []byte(`"<item/>"
+"<item>a</item>"
+"<item/>"
+`),
+		},
+		{name: "between elements one byte at a time",
+			cmd: `y<item> p%"%q\n"`,
+			in:  oneByteAtATime("x<item/><item>a</item><item/>"),
+			out: []byte(`""
+"a"
+""
+`),
+		},
+		{name: "namespaced elements",
+			cmd: `y<x:item> p"\n"`,
+			in:  xmlDoc,
+			out: []byte("ns\n"),
+		},
+		{name: "nested extraction",
+			cmd: `x<list> y<b> p"\n"`,
+			in:  xmlDoc,
+			out: []byte("bold\n"),
+		},
+		{name: "html void elements",
+			cmd: `y<p> p"\n"`,
+			in:  xmlDoc,
+			out: []byte("para<br>break\n"),
+		},
+		{name: "angle brackets still balance",
+			cmd: `x<2 p"\n"`,
+			in:  []byte(`<a <b> <c>>`),
+			out: []byte("<b>\n<c>\n"),
+		},
+	}.run(t)
+}